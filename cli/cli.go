@@ -0,0 +1,225 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Command line interface of qserv-tools: a tree of commands, like "metadata generate", sharing
+// global flags, which can be given before the command or with its own flags
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fjammes/qserv-tools/v2/config"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Name of the program in usage messages and completion scripts
+const programName = "qserv-tools"
+
+// Formats of the logs and of the reports printed by the commands, see the -output flag
+const (
+	OutputJSON = "json"
+	OutputText = "text"
+)
+
+// globals are the options shared by all commands
+type globals struct {
+	debug  bool
+	output string
+}
+
+// env is passed to the commands: the configuration of the tools and the global options,
+// which are set once flags are parsed
+type env struct {
+	globals
+	conf config.Config
+	opts config.Options
+}
+
+func (e *env) jsonOutput() bool {
+	return e.output == OutputJSON
+}
+
+// command is a node of the command tree. Leaves define their flags with setup, which returns
+// the function running the command with the positional arguments, once flags are parsed
+type command struct {
+	name    string
+	summary string
+	// Usage of the positional arguments, which are rejected if empty
+	args  string
+	setup func(flags *flag.FlagSet, e *env) func(args []string)
+	// Subcommands of a group
+	subcommands []*command
+	// Subcommand run when the group is followed by flags or nothing, like "generate" for "metadata"
+	defaultSub string
+}
+
+// newRoot returns the command tree
+func newRoot() *command {
+	return &command{
+		name: programName,
+		subcommands: []*command{
+			metadataCommand(),
+			ingestCommand(),
+			dbbenchCommand(),
+			schemaCommand(),
+			databaseCommand(),
+			configCommand(),
+			versionCommand(),
+			completionCommand(),
+		},
+	}
+}
+
+// register adds the global flags to flags, their current values being the defaults
+func (g *globals) register(flags *flag.FlagSet) {
+	flags.BoolVar(&g.debug, "debug", g.debug, "sets log level to debug")
+	flags.StringVar(&g.output, "output", g.output, "Format of logs and reports: json or text")
+	config.AddFlags(flags)
+}
+
+// setupLogging sets log level to info, unless debug flag is present, and writes human readable logs
+// with the text output
+func (g *globals) setupLogging() {
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	if g.debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+	if g.output == OutputText {
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	}
+}
+
+func (c *command) find(name string) *command {
+	for _, sub := range c.subcommands {
+		if sub.name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// resolve returns the command selected by args, its path from the root and its arguments
+func resolve(root *command, args []string) (*command, []string, []string, error) {
+	c := root
+	path := []string{root.name}
+	for c.setup == nil {
+		var sub *command
+		if len(args) != 0 {
+			sub = c.find(args[0])
+		}
+		switch {
+		case sub != nil:
+			args = args[1:]
+		case c.defaultSub != "" && (len(args) == 0 || (strings.HasPrefix(args[0], "-") && !isHelp(args[0]))):
+			sub = c.find(c.defaultSub)
+		case len(args) == 0 || isHelp(args[0]) || args[0] == "help":
+			return c, path, nil, flag.ErrHelp
+		default:
+			return c, path, nil, fmt.Errorf("unknown command %q", strings.Join(append(path[1:], args[0]), " "))
+		}
+		c = sub
+		path = append(path, sub.name)
+	}
+	return c, path, args, nil
+}
+
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// usage writes the usage of a command, its subcommands or its flags
+func (c *command) usage(w io.Writer, path []string, flags *flag.FlagSet) {
+	name := strings.Join(path, " ")
+	if c.setup != nil {
+		fmt.Fprintf(w, "Usage: %s [flags] %s\n\n%s\n\nFlags:\n", name, c.args, c.summary)
+		flags.SetOutput(w)
+		flags.PrintDefaults()
+		return
+	}
+	if len(path) == 1 {
+		fmt.Fprintf(w, "Usage: %s [global flags] <command> [<subcommand>] [flags] [arguments]\n\nCommands:\n", name)
+	} else {
+		fmt.Fprintf(w, "Usage: %s <subcommand> [flags] [arguments]\n\n%s\n\nSubcommands:\n", name, c.summary)
+	}
+	for _, sub := range c.subcommands {
+		summary := sub.summary
+		if sub.name == c.defaultSub {
+			summary += " (default)"
+		}
+		fmt.Fprintf(w, "  %-18s %s\n", sub.name, summary)
+	}
+	fmt.Fprintf(w, "\nGlobal flags:\n")
+	g := globals{output: OutputJSON}
+	global := flag.NewFlagSet(name, flag.ContinueOnError)
+	g.register(global)
+	global.SetOutput(w)
+	global.PrintDefaults()
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for help on a command.\n", programName)
+}
+
+// Main runs the command selected by args, the command line arguments without the program name.
+// Global flags are accepted before the command name
+func Main(args []string) {
+	root := newRoot()
+	g := globals{output: OutputJSON}
+	flags := flag.NewFlagSet(programName, flag.ExitOnError)
+	g.register(flags)
+	flags.Usage = func() { root.usage(os.Stderr, []string{programName}, flags) }
+	flags.Parse(args)
+
+	c, path, cmdArgs, err := resolve(root, flags.Args())
+	if err == flag.ErrHelp {
+		c.usage(os.Stdout, path, nil)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		c.usage(os.Stderr, path, nil)
+		os.Exit(2)
+	}
+
+	e := &env{globals: g, opts: config.ParseOptions(args)}
+	e.conf = config.FromArgs(args)
+	cmdFlags := flag.NewFlagSet(strings.Join(path, " "), flag.ExitOnError)
+	e.globals.register(cmdFlags)
+	run := c.setup(cmdFlags, e)
+	cmdFlags.Usage = func() { c.usage(os.Stderr, path, cmdFlags) }
+	cmdFlags.Parse(cmdArgs)
+	if c.args == "" && cmdFlags.NArg() != 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected arguments %v\n\n", cmdFlags.Args())
+		cmdFlags.Usage()
+		os.Exit(2)
+	}
+	if e.output != OutputJSON && e.output != OutputText {
+		log.Fatal().Str("Output", e.output).Msg("Error: output must be json or text")
+	}
+	e.setupLogging()
+	run(cmdFlags.Args())
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	root := newRoot()
+	tests := []struct {
+		args     []string
+		path     []string
+		cmdArgs  []string
+		wantHelp bool
+	}{
+		{args: []string{"metadata", "diff", "a.json", "b.json"}, path: []string{"qserv-tools", "metadata", "diff"}, cmdArgs: []string{"a.json", "b.json"}},
+		{args: []string{"metadata", "--path", "/data"}, path: []string{"qserv-tools", "metadata", "generate"}, cmdArgs: []string{"--path", "/data"}},
+		{args: []string{"metadata"}, path: []string{"qserv-tools", "metadata", "generate"}, cmdArgs: []string{}},
+		{args: []string{"ingest", "-h"}, path: []string{"qserv-tools", "ingest"}, wantHelp: true},
+		{args: []string{"help"}, path: []string{"qserv-tools"}, wantHelp: true},
+		{args: []string{}, path: []string{"qserv-tools"}, wantHelp: true},
+		{args: []string{"version"}, path: []string{"qserv-tools", "version"}, cmdArgs: []string{}},
+	}
+	for _, test := range tests {
+		_, path, cmdArgs, err := resolve(root, test.args)
+		if test.wantHelp {
+			assert.Equal(t, flag.ErrHelp, err, test.args)
+		} else {
+			assert.NoError(t, err, test.args)
+			assert.Equal(t, test.cmdArgs, cmdArgs, test.args)
+		}
+		assert.Equal(t, test.path, path, test.args)
+	}
+
+	_, _, _, err := resolve(root, []string{"metadata", "generat"})
+	assert.EqualError(t, err, `unknown command "metadata generat"`)
+	// Global flags are parsed by Main before the command name
+	_, _, _, err = resolve(root, []string{"--debug"})
+	assert.EqualError(t, err, `unknown command "--debug"`)
+}
+
+func TestUsage(t *testing.T) {
+	root := newRoot()
+	var out bytes.Buffer
+	root.find("metadata").usage(&out, []string{"qserv-tools", "metadata"}, nil)
+	assert.Contains(t, out.String(), "Usage: qserv-tools metadata <subcommand>")
+	assert.Contains(t, out.String(), "  generate           Generate metadata.json from a data directory (default)\n")
+	assert.Contains(t, out.String(), "  -output string")
+
+	out.Reset()
+	diff := root.find("metadata").find("diff")
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	diff.setup(flags, &env{})
+	diff.usage(&out, []string{"qserv-tools", "metadata", "diff"}, flags)
+	assert.Contains(t, out.String(), "Usage: qserv-tools metadata diff [flags] <old.json> <new.json>\n")
+	assert.Contains(t, out.String(), "  -exit-code")
+}
@@ -0,0 +1,138 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Command printing shell completion scripts, generated from the command tree
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/fjammes/qserv-tools/v2/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+func completionCommand() *command {
+	return &command{
+		name:    "completion",
+		summary: "Print the completion script of a shell, bash or zsh",
+		args:    "bash|zsh",
+		setup:   completion,
+	}
+}
+
+// completion prints the script, to be sourced by the shell:
+// source <(qserv-tools completion bash)
+func completion(flags *flag.FlagSet, e *env) func(args []string) {
+	return func(args []string) {
+		if len(args) != 1 {
+			log.Fatal().Strs("Arguments", args).Msg("Error: a shell, bash or zsh, is required")
+		}
+		switch args[0] {
+		case "bash":
+			writeBashCompletion(os.Stdout, newRoot())
+		case "zsh":
+			fmt.Fprintln(os.Stdout, "autoload -U +X bashcompinit && bashcompinit")
+			writeBashCompletion(os.Stdout, newRoot())
+		default:
+			log.Fatal().Str("Shell", args[0]).Msg("Error: shell must be bash or zsh")
+		}
+	}
+}
+
+// flagNames returns the flags of a command, global flags included, as they are completed
+func flagNames(c *command) []string {
+	e := &env{globals: globals{output: OutputJSON}, conf: config.Defaults()}
+	flags := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	e.globals.register(flags)
+	if c.setup != nil {
+		c.setup(flags, e)
+	}
+	var names []string
+	flags.VisitAll(func(f *flag.Flag) {
+		names = append(names, "--"+f.Name)
+	})
+	return names
+}
+
+// completionWords returns the words completed after each command path, the path being the command
+// names separated by spaces. A group with a default subcommand also completes the flags of this subcommand
+func completionWords(c *command, path string, words map[string][]string) {
+	var w []string
+	for _, sub := range c.subcommands {
+		w = append(w, sub.name)
+		completionWords(sub, strings.TrimSpace(path+" "+sub.name), words)
+	}
+	switch {
+	case c.setup != nil:
+		w = flagNames(c)
+		// Arguments given as alternatives, like "bash|zsh"
+		if c.args != "" && !strings.ContainsAny(c.args, "<[") {
+			w = append(strings.Split(c.args, "|"), w...)
+		}
+	case c.defaultSub != "":
+		w = append(w, flagNames(c.find(c.defaultSub))...)
+	default:
+		w = append(w, flagNames(&command{name: c.name})...)
+	}
+	words[path] = w
+}
+
+func writeBashCompletion(w io.Writer, root *command) {
+	words := make(map[string][]string)
+	completionWords(root, "", words)
+	paths := make([]string, 0, len(words))
+	for path := range words {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	function := "_" + strings.ReplaceAll(programName, "-", "_")
+	fmt.Fprintf(w, "# %s completion, generated by '%s completion'\n", programName, programName)
+	fmt.Fprintf(w, "%s() {\n", function)
+	fmt.Fprintf(w, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\" path=\"\" word i\n")
+	fmt.Fprintf(w, "    for ((i = 1; i < COMP_CWORD; i++)); do\n")
+	fmt.Fprintf(w, "        word=\"${COMP_WORDS[i]}\"\n")
+	fmt.Fprintf(w, "        case \"${path:+$path }$word\" in\n")
+	for _, path := range paths {
+		if path != "" {
+			fmt.Fprintf(w, "        %q) path=\"${path:+$path }$word\" ;;\n", path)
+		}
+	}
+	fmt.Fprintf(w, "        esac\n")
+	fmt.Fprintf(w, "    done\n")
+	fmt.Fprintf(w, "    local words\n")
+	fmt.Fprintf(w, "    case \"$path\" in\n")
+	for _, path := range paths {
+		fmt.Fprintf(w, "    %q) words=%q ;;\n", path, strings.Join(words[path], " "))
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o default -F %s %s\n", function, programName)
+}
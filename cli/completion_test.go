@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompletionWords(t *testing.T) {
+	words := make(map[string][]string)
+	completionWords(newRoot(), "", words)
+	assert.Subset(t, words[""], []string{"metadata", "ingest", "dbbench", "version", "--debug", "--output", "--config", "--profile"})
+	assert.Subset(t, words["metadata"], []string{"generate", "validate", "diff", "--path", "--debug"})
+	assert.Subset(t, words["metadata diff"], []string{"--exit-code", "--output"})
+	assert.NotContains(t, words["metadata diff"], "--path")
+	assert.Subset(t, words["completion"], []string{"bash", "zsh"})
+	assert.Subset(t, words["database generate"], []string{"--replication-config", "--config"})
+}
+
+func TestWriteBashCompletion(t *testing.T) {
+	var out bytes.Buffer
+	writeBashCompletion(&out, newRoot())
+	assert.Contains(t, out.String(), "        \"metadata diff\") path=\"${path:+$path }$word\" ;;\n")
+	assert.Contains(t, out.String(), "complete -o default -F _qserv_tools qserv-tools\n")
+}
@@ -0,0 +1,48 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Command printing the effective configuration of the tools
+
+package cli
+
+import (
+	"flag"
+
+	"github.com/fjammes/qserv-tools/v2/config"
+)
+
+func configCommand() *command {
+	return &command{
+		name:       "config",
+		summary:    "Print the configuration of the tools",
+		defaultSub: "show",
+		subcommands: []*command{
+			{name: "show", summary: "Print the effective configuration, with the file, profile and environment variables it comes from", setup: configShow},
+		},
+	}
+}
+
+func configShow(flags *flag.FlagSet, e *env) func(args []string) {
+	return func(args []string) {
+		config.Show(e.opts, e.jsonOutput())
+	}
+}
@@ -0,0 +1,51 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Command generating the dbbench configuration of a Qserv integration test case
+
+package cli
+
+import (
+	"flag"
+
+	"github.com/fjammes/qserv-tools/v2/dbbench"
+)
+
+func dbbenchCommand() *command {
+	return &command{
+		name:       "dbbench",
+		summary:    "Generate dbbench configuration from Qserv integration tests",
+		defaultSub: "generate",
+		subcommands: []*command{
+			{name: "generate", summary: "Generate the dbbench configuration of a test case", setup: dbbenchGenerate},
+		},
+	}
+}
+
+func dbbenchGenerate(flags *flag.FlagSet, e *env) func(args []string) {
+	qservSrcPath := flags.String("qserv_src_path", e.conf.DBBench.QservSrcPath, "Path to Qserv source code")
+	caseId := flags.String("case_id", e.conf.DBBench.CaseId, "Test case to extract")
+	dbbenchConf := flags.String("dbbench_conf", e.conf.DBBench.DbbenchConf, "Path to dbbench output file")
+	return func(args []string) {
+		dbbench.Generate(*qservSrcPath, *caseId, *dbbenchConf)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Commands querying the replication controller of a Qserv instance running in Kubernetes
+
+package cli
+
+import (
+	"flag"
+
+	"github.com/fjammes/qserv-tools/v2/ingest"
+)
+
+func ingestCommand() *command {
+	return &command{
+		name:       "ingest",
+		summary:    "Query the replication controller of a Qserv instance",
+		defaultSub: "databases",
+		subcommands: []*command{
+			{name: "databases", summary: "List the databases registered in the replication controller", setup: databases},
+		},
+	}
+}
+
+// addControllerFlags adds the flags locating the replication controller pod
+func addControllerFlags(flags *flag.FlagSet, e *env) *ingest.Controller {
+	c := &ingest.Controller{}
+	flags.StringVar(&c.Kubeconfig, "kubeconfig", e.conf.Ingest.Kubeconfig, "(optional) absolute path to the kubeconfig file")
+	flags.StringVar(&c.Namespace, "namespace", e.conf.Ingest.Namespace, "Namespace of the replication controller pod")
+	flags.StringVar(&c.Pod, "pod", e.conf.Ingest.Pod, "Name of the replication controller pod")
+	flags.StringVar(&c.URL, "url", e.conf.Ingest.URL, "URL of the replication controller, from inside its pod")
+	return c
+}
+
+// databases lists the databases registered in the replication controller
+func databases(flags *flag.FlagSet, e *env) func(args []string) {
+	c := addControllerFlags(flags, e)
+	return func(args []string) {
+		ingest.Databases(*c, e.jsonOutput())
+	}
+}
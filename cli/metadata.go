@@ -0,0 +1,467 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Commands generating, checking and transforming metadata.json files
+
+package cli
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fjammes/qserv-tools/v2/lint"
+	"github.com/fjammes/qserv-tools/v2/metadata"
+	"github.com/fjammes/qserv-tools/v2/partition"
+
+	"github.com/rs/zerolog/log"
+)
+
+func metadataCommand() *command {
+	return &command{
+		name:       "metadata",
+		summary:    "Generate, check and transform metadata.json files",
+		defaultSub: "generate",
+		subcommands: []*command{
+			{name: "generate", summary: "Generate metadata.json from a data directory", setup: generate},
+			{name: "validate", summary: "Validate metadata.json, table schema and database JSON files against their JSON Schema", args: "[<file.json>...]", setup: validate},
+			{name: "diff", summary: "Compare the tables, data entries and chunks of two metadata.json files", args: "<old.json> <new.json>", setup: diff},
+			{name: "verify", summary: "Check data files against a checksum manifest", setup: verify},
+			{name: "check-data", summary: "Check rows of data files against table schemas", setup: checkData},
+			{name: "check-chunks", summary: "Check positions of chunk file rows against their chunk", setup: checkChunks},
+			{name: "check-duplicates", summary: "Check director keys are unique across chunk files", setup: checkDuplicates},
+			{name: "check-references", summary: "Check child rows reference director rows in the same chunk", setup: checkReferences},
+			{name: "coverage", summary: "Compare chunks of director and child tables of a metadata.json file", setup: coverage},
+			{name: "migrate", summary: "Convert a metadata.json file to another format version", setup: migrate},
+			{name: "subset", summary: "Copy selected chunks of a data directory into a new tree, with its metadata.json", setup: subset},
+			{name: "stage", summary: "Link the data files of several source directories into a staging tree", setup: stage},
+			{name: "watch", summary: "Keep metadata.json up to date while data files are written to a directory", setup: watch},
+		},
+	}
+}
+
+// addScanFlags adds the flags selecting the files of the input data to flags, and returns
+// a function setting them in a configuration once flags are parsed
+func addScanFlags(flags *flag.FlagSet) func(cfg *metadata.Config) {
+	include := flags.String("include", "", "Comma separated glob patterns of the files to scan, all files if empty")
+	exclude := flags.String("exclude", "", "Comma separated glob patterns of the files to ignore, like '*.md,.DS_Store'")
+	unknown := flags.String("unknown", "fail", "Policy for unrecognized files: ignore, warn or fail")
+	template := flags.String("template", "", "Path template deriving table names, like '{table}/chunks/{run}/{file}', the first path component being the table name if empty")
+	return func(cfg *metadata.Config) {
+		cfg.PathTemplate = *template
+		var err error
+		cfg.Include, err = metadata.ParsePatterns(*include)
+		if err != nil {
+			log.Fatal().AnErr("Include", err).Msg("Error in configuration")
+		}
+		cfg.Exclude, err = metadata.ParsePatterns(*exclude)
+		if err != nil {
+			log.Fatal().AnErr("Exclude", err).Msg("Error in configuration")
+		}
+		cfg.UnknownFiles, err = metadata.ParseUnknownPolicy(*unknown)
+		if err != nil {
+			log.Fatal().AnErr("Unknown", err).Msg("Error in configuration")
+		}
+	}
+}
+
+// generate creates metadata.json from a data directory
+func generate(flags *flag.FlagSet, e *env) func(args []string) {
+	inputDir := flags.String("path", e.conf.Metadata.Path, "Path to input data, directory or tar archive")
+	outFile := flags.String("out", e.conf.Metadata.Out, "Path to output file")
+	idxDir := flags.String("idx", e.conf.Metadata.Idx, "Path to indexes configuration files")
+	orderedTablesStr := flags.String("o", strings.Join(e.conf.Metadata.Order, " "), "Ingest order for tables")
+	dbJsonFile := flags.String("db", e.conf.Metadata.Db, "Name of the database JSON file, see cmd/database")
+	archiveRoot := flags.String("root", "", "Directory containing table directories inside the tar archive")
+	extractDir := flags.String("extract", "", "Extract the tar archive to this directory and check extracted file sizes against the archive")
+	checksum := flags.String("checksum", "", "Write a manifest of data files checksums, using sha256 or xxhash")
+	workers := flags.Int("j", 0, "Number of files processed in parallel, defaults to the number of CPUs")
+	filePolicyStr := flags.String("file-checks", "", "Policy for empty, truncated and abnormally sized data files: warn, skip or fail, disabled if empty")
+	tablePoliciesStr := flags.String("table-policies", "", "Per table policies overriding -file-checks, like Object=fail,Source=skip")
+	compact := flags.Bool("compact", false, "Write metadata.json without indentation")
+	reportFile := flags.String("report", "", "Write the validation report, listing findings with their severity, to this JSON file")
+	strict := flags.Bool("strict", false, "Promote warnings of the validation report to errors, failing the generation")
+	provenanceFile := flags.String("provenance", "", "Write a report of the tract, step and timestamp of each data entry to this file")
+	var provenancePatterns []string
+	flags.Func("provenance-pattern", "Regular expression extracting provenance from directory names with named groups, like '_tract_(?P<tract>[0-9]+)_', can be repeated", func(s string) error {
+		provenancePatterns = append(provenancePatterns, s)
+		return nil
+	})
+	tractsStr := flags.String("tracts", "", "Comma separated tracts of the data entries to add, all tracts if empty")
+	stepsStr := flags.String("steps", "", "Comma separated glob patterns of the steps of the data entries to add, like 'step5_*'")
+	afterStr := flags.String("after", "", "Add data entries produced at or after this time, like 20220505T000000Z or 2022-05-05")
+	beforeStr := flags.String("before", "", "Add data entries produced before this time")
+	setScanFlags := addScanFlags(flags)
+	return func(args []string) {
+		steps, err := metadata.ParsePatterns(*stepsStr)
+		if err != nil {
+			log.Fatal().AnErr("Steps", err).Msg("Error in configuration")
+		}
+		after, err := metadata.ParseTime(*afterStr)
+		if err != nil {
+			log.Fatal().AnErr("After", err).Msg("Error in configuration")
+		}
+		before, err := metadata.ParseTime(*beforeStr)
+		if err != nil {
+			log.Fatal().AnErr("Before", err).Msg("Error in configuration")
+		}
+		filePolicy, err := metadata.ParseFilePolicy(*filePolicyStr)
+		if err != nil {
+			log.Fatal().AnErr("Policy", err).Msg("Error in configuration")
+		}
+		tablePolicies, err := metadata.ParseFilePolicies(*tablePoliciesStr)
+		if err != nil {
+			log.Fatal().AnErr("Policy", err).Msg("Error in configuration")
+		}
+
+		cfg := metadata.Config{
+			DbJsonFile:    *dbJsonFile,
+			OrderedTables: strings.Fields(*orderedTablesStr),
+			IdxDir:        *idxDir,
+			ArchiveRoot:   *archiveRoot,
+			Checksum:      *checksum,
+			Workers:       *workers,
+			FilePolicy:    filePolicy,
+			TablePolicies: tablePolicies,
+			Compact:       *compact,
+			ReportFile:    *reportFile,
+			Strict:        *strict,
+
+			ProvenancePatterns: provenancePatterns,
+			ProvenanceFile:     *provenanceFile,
+			Tracts:             strings.FieldsFunc(*tractsStr, func(r rune) bool { return r == ',' }),
+			Steps:              steps,
+			After:              after,
+			Before:             before,
+		}
+		setScanFlags(&cfg)
+
+		if *extractDir != "" {
+			metadata.Extract(*inputDir, *extractDir, cfg)
+		}
+
+		metadata.Cmd(*inputDir, *outFile, cfg)
+	}
+}
+
+// verify checks data files against a checksum manifest
+func verify(flags *flag.FlagSet, e *env) func(args []string) {
+	inputDir := flags.String("path", e.conf.Metadata.Path, "Path to input data")
+	manifest := flags.String("manifest", "/tmp/manifest.sha256", "Path to checksum manifest")
+	workers := flags.Int("j", 0, "Number of files processed in parallel, defaults to the number of CPUs")
+	return func(args []string) {
+		cfg := metadata.Config{
+			Workers: *workers,
+		}
+		metadata.Verify(*inputDir, *manifest, cfg)
+	}
+}
+
+// checkData checks rows of data files against table schemas
+func checkData(flags *flag.FlagSet, e *env) func(args []string) {
+	inputDir := flags.String("path", e.conf.Metadata.Path, "Path to input data")
+	schemaDir := flags.String("schema", "", "Path to table schema JSON files, defaults to input data path")
+	delimiter := flags.String("delimiter", ",", "Field delimiter of chunk files")
+	values := flags.Bool("values", false, "Check values against column types and nullability")
+	sampleRows := flags.Int("sample", 0, "Number of rows checked in each file, 0 for all rows")
+	workers := flags.Int("j", 0, "Number of files processed in parallel, defaults to the number of CPUs")
+	setScanFlags := addScanFlags(flags)
+	return func(args []string) {
+		sep := []rune(*delimiter)
+		if len(sep) != 1 {
+			log.Fatal().Str("Delimiter", *delimiter).Msg("Error: delimiter must be a single character")
+		}
+		cfg := metadata.Config{
+			SchemaDir:   *schemaDir,
+			Delimiter:   sep[0],
+			CheckValues: *values,
+			SampleRows:  *sampleRows,
+			Workers:     *workers,
+		}
+		setScanFlags(&cfg)
+		metadata.CheckData(*inputDir, cfg)
+	}
+}
+
+// checkChunks checks positions of chunk file rows against their chunk
+func checkChunks(flags *flag.FlagSet, e *env) func(args []string) {
+	inputDir := flags.String("path", e.conf.Metadata.Path, "Path to input data")
+	schemaDir := flags.String("schema", "", "Path to table schema and database JSON files, defaults to input data path")
+	dbJsonFile := flags.String("db", "database.json", "Name of the database JSON file, containing partitioning parameters")
+	delimiter := flags.String("delimiter", ",", "Field delimiter of chunk files")
+	sampleRows := flags.Int("sample", 0, "Number of rows checked in each file, 0 for all rows")
+	workers := flags.Int("j", 0, "Number of files processed in parallel, defaults to the number of CPUs")
+	setScanFlags := addScanFlags(flags)
+	return func(args []string) {
+		sep := []rune(*delimiter)
+		if len(sep) != 1 {
+			log.Fatal().Str("Delimiter", *delimiter).Msg("Error: delimiter must be a single character")
+		}
+		cfg := metadata.Config{
+			DbJsonFile: *dbJsonFile,
+			SchemaDir:  *schemaDir,
+			Delimiter:  sep[0],
+			SampleRows: *sampleRows,
+			Workers:    *workers,
+		}
+		setScanFlags(&cfg)
+		metadata.CheckChunks(*inputDir, cfg)
+	}
+}
+
+// checkDuplicates checks director keys are unique across chunk files
+func checkDuplicates(flags *flag.FlagSet, e *env) func(args []string) {
+	inputDir := flags.String("path", e.conf.Metadata.Path, "Path to input data")
+	schemaDir := flags.String("schema", "", "Path to table schema JSON files, defaults to input data path")
+	delimiter := flags.String("delimiter", ",", "Field delimiter of chunk files")
+	shards := flags.Int("shards", 64, "Number of temporary shard files, increase it to reduce memory usage")
+	tmpDir := flags.String("tmp", "", "Directory of temporary shard files, defaults to the system one")
+	workers := flags.Int("j", 0, "Number of files processed in parallel, defaults to the number of CPUs")
+	setScanFlags := addScanFlags(flags)
+	return func(args []string) {
+		sep := []rune(*delimiter)
+		if len(sep) != 1 {
+			log.Fatal().Str("Delimiter", *delimiter).Msg("Error: delimiter must be a single character")
+		}
+		cfg := metadata.Config{
+			SchemaDir: *schemaDir,
+			Delimiter: sep[0],
+			Shards:    *shards,
+			TmpDir:    *tmpDir,
+			Workers:   *workers,
+		}
+		setScanFlags(&cfg)
+		metadata.CheckDuplicates(*inputDir, cfg)
+	}
+}
+
+// checkReferences checks child rows reference director rows in the same chunk
+func checkReferences(flags *flag.FlagSet, e *env) func(args []string) {
+	inputDir := flags.String("path", e.conf.Metadata.Path, "Path to input data")
+	schemaDir := flags.String("schema", "", "Path to table schema JSON files, defaults to input data path")
+	delimiter := flags.String("delimiter", ",", "Field delimiter of chunk files")
+	shards := flags.Int("shards", 64, "Number of temporary shard files, increase it to reduce memory usage")
+	tmpDir := flags.String("tmp", "", "Directory of temporary shard files, defaults to the system one")
+	workers := flags.Int("j", 0, "Number of files processed in parallel, defaults to the number of CPUs")
+	setScanFlags := addScanFlags(flags)
+	return func(args []string) {
+		sep := []rune(*delimiter)
+		if len(sep) != 1 {
+			log.Fatal().Str("Delimiter", *delimiter).Msg("Error: delimiter must be a single character")
+		}
+		cfg := metadata.Config{
+			SchemaDir: *schemaDir,
+			Delimiter: sep[0],
+			Shards:    *shards,
+			TmpDir:    *tmpDir,
+			Workers:   *workers,
+		}
+		setScanFlags(&cfg)
+		metadata.CheckReferences(*inputDir, cfg)
+	}
+}
+
+// coverage compares chunks of director and child tables of a metadata.json file
+func coverage(flags *flag.FlagSet, e *env) func(args []string) {
+	metadataFile := flags.String("metadata", e.conf.Metadata.Out, "Path to metadata.json file")
+	schemaDir := flags.String("schema", "", "Path to table schema JSON files, defaults to metadata file directory")
+	outFile := flags.String("out", "", "Path to JSON coverage report, not written if empty")
+	return func(args []string) {
+		cfg := metadata.Config{
+			SchemaDir: *schemaDir,
+		}
+		metadata.Coverage(*metadataFile, *outFile, cfg)
+	}
+}
+
+// migrate converts a metadata.json file to another format version
+func migrate(flags *flag.FlagSet, e *env) func(args []string) {
+	inFile := flags.String("metadata", e.conf.Metadata.Out, "Path to metadata.json file")
+	outFile := flags.String("out", "", "Path to output file, required")
+	version := flags.Int("version", metadata.MetadataVersion, "Format version of the output file, lower versions being read by older releases of qserv-ingest")
+	compact := flags.Bool("compact", false, "Write metadata.json without indentation")
+	return func(args []string) {
+		if *outFile == "" {
+			log.Fatal().Msg("Error: --out is required")
+		}
+		cfg := metadata.Config{
+			Compact: *compact,
+		}
+		metadata.Migrate(*inFile, *outFile, *version, cfg)
+	}
+}
+
+// subset copies selected chunks of a data directory into a new tree, with its metadata.json
+func subset(flags *flag.FlagSet, e *env) func(args []string) {
+	inputDir := flags.String("path", e.conf.Metadata.Path, "Path to input data")
+	outDir := flags.String("out", "/tmp/subset", "Path to output directory, which must not exist")
+	schemaDir := flags.String("schema", "", "Path to table schema and database JSON files, defaults to input data path")
+	idxDir := flags.String("idx", "", "Path to indexes configuration files")
+	dbJsonFile := flags.String("db", "database.json", "Name of the database JSON file, containing partitioning parameters")
+	orderedTablesStr := flags.String("o", "", "Ingest order for tables")
+	chunksStr := flags.String("chunks", "", "Comma separated ids of the selected chunks")
+	boxStr := flags.String("box", "", "Select chunks intersecting a sky box, like lonMin,lonMax,latMin,latMax in degrees")
+	tractsStr := flags.String("tracts", "", "Comma separated tracts, selecting the chunks of their data entries")
+	sample := flags.Int("sample", 0, "Number of chunks randomly selected among the matching ones, all of them if 0")
+	seed := flags.Int64("seed", 1, "Seed of the random sample")
+	linkStr := flags.String("link", "copy", "Way files are added to the subset: copy, hard or symlink")
+	compact := flags.Bool("compact", false, "Write metadata.json without indentation")
+	workers := flags.Int("j", 0, "Number of files processed in parallel, defaults to the number of CPUs")
+	setScanFlags := addScanFlags(flags)
+	return func(args []string) {
+		link, err := metadata.ParseLinkMode(*linkStr)
+		if err != nil {
+			log.Fatal().AnErr("Link", err).Msg("Error in configuration")
+		}
+		chunks, err := metadata.ParseChunkIds(*chunksStr)
+		if err != nil {
+			log.Fatal().AnErr("Chunks", err).Msg("Error in configuration")
+		}
+		sel := metadata.ChunkSelection{
+			Chunks: chunks,
+			Tracts: strings.FieldsFunc(*tractsStr, func(r rune) bool { return r == ',' }),
+			Sample: *sample,
+			Seed:   *seed,
+			Link:   link,
+		}
+		if *boxStr != "" {
+			box, err := partition.ParseBox(*boxStr)
+			if err != nil {
+				log.Fatal().AnErr("Box", err).Msg("Error in configuration")
+			}
+			sel.Box = &box
+		}
+		cfg := metadata.Config{
+			DbJsonFile:    *dbJsonFile,
+			OrderedTables: strings.Fields(*orderedTablesStr),
+			IdxDir:        *idxDir,
+			SchemaDir:     *schemaDir,
+			Workers:       *workers,
+			Compact:       *compact,
+		}
+		setScanFlags(&cfg)
+		metadata.Subset(*inputDir, *outDir, sel, cfg)
+	}
+}
+
+// stage links the data files of several source directories into a staging tree, with its metadata.json
+func stage(flags *flag.FlagSet, e *env) func(args []string) {
+	var sources []string
+	flags.Func("source", "Path to a source data directory, can be repeated", func(s string) error {
+		sources = append(sources, s)
+		return nil
+	})
+	outDir := flags.String("out", "/tmp/staging", "Path to staging directory, which must not exist")
+	schemaDir := flags.String("schema", "", "Path to table schema and database JSON files, defaults to the first source")
+	idxDir := flags.String("idx", "", "Path to indexes configuration files")
+	dbJsonFile := flags.String("db", "database.json", "Name of the database JSON file")
+	orderedTablesStr := flags.String("o", "", "Ingest order for tables")
+	linkStr := flags.String("link", "symlink", "Way files are added to the staging tree: symlink, hard or copy")
+	collisionsStr := flags.String("collisions", "rename", "Policy for data directories with the same staged name: rename or fail")
+	compact := flags.Bool("compact", false, "Write metadata.json without indentation")
+	workers := flags.Int("j", 0, "Number of files processed in parallel, defaults to the number of CPUs")
+	setScanFlags := addScanFlags(flags)
+	return func(args []string) {
+		link, err := metadata.ParseLinkMode(*linkStr)
+		if err != nil {
+			log.Fatal().AnErr("Link", err).Msg("Error in configuration")
+		}
+		collisions, err := metadata.ParseCollisionPolicy(*collisionsStr)
+		if err != nil {
+			log.Fatal().AnErr("Collisions", err).Msg("Error in configuration")
+		}
+		cfg := metadata.Config{
+			DbJsonFile:    *dbJsonFile,
+			OrderedTables: strings.Fields(*orderedTablesStr),
+			IdxDir:        *idxDir,
+			SchemaDir:     *schemaDir,
+			Workers:       *workers,
+			Compact:       *compact,
+		}
+		setScanFlags(&cfg)
+		metadata.Stage(sources, *outDir, link, collisions, cfg)
+	}
+}
+
+// watch keeps metadata.json up to date while data files are written to a directory
+func watch(flags *flag.FlagSet, e *env) func(args []string) {
+	inputDir := flags.String("path", e.conf.Metadata.Path, "Path to input data")
+	outFile := flags.String("out", e.conf.Metadata.Out, "Path to output file, rewritten atomically")
+	eventsFile := flags.String("events", "", "Append events, as JSON lines, to this file instead of the standard output")
+	idxDir := flags.String("idx", "", "Path to indexes configuration files")
+	dbJsonFile := flags.String("db", e.conf.Metadata.Db, "Name of the database JSON file, see cmd/database")
+	interval := flags.Duration("interval", 30*time.Second, "Delay between updates of the output file")
+	settle := flags.Duration("settle", 5*time.Minute, "Delay without change after which a data directory is completed")
+	compact := flags.Bool("compact", false, "Write metadata.json without indentation")
+	setScanFlags := addScanFlags(flags)
+	return func(args []string) {
+		cfg := metadata.Config{
+			DbJsonFile: *dbJsonFile,
+			IdxDir:     *idxDir,
+			Compact:    *compact,
+		}
+		setScanFlags(&cfg)
+		metadata.Watch(*inputDir, *outFile, *eventsFile, *interval, *settle, cfg)
+	}
+}
+
+// validate checks JSON files against their JSON Schema, the generated metadata.json file by default
+func validate(flags *flag.FlagSet, e *env) func(args []string) {
+	kindName := flags.String("kind", "", "Kind of the files, metadata, table or database, detected for each file if empty")
+	printSchema := flags.String("print-schema", "", "Print the JSON Schema of a file kind and exit")
+	return func(args []string) {
+		if *printSchema != "" {
+			kind, err := lint.ParseKind(*printSchema)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Error in configuration")
+			}
+			content, err := lint.Schema(kind)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Error while reading schema")
+			}
+			os.Stdout.Write(content)
+			return
+		}
+		kind, err := lint.ParseKind(*kindName)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error in configuration")
+		}
+		if len(args) == 0 {
+			args = []string{e.conf.Metadata.Out}
+		}
+		lint.Cmd(args, kind, e.jsonOutput())
+	}
+}
+
+// diff prints the differences between two metadata.json files
+func diff(flags *flag.FlagSet, e *env) func(args []string) {
+	exitCode := flags.Bool("exit-code", false, "Exit with status 1 if the files differ")
+	return func(args []string) {
+		if len(args) != 2 {
+			log.Fatal().Strs("Arguments", args).Msg("Error: two metadata files are required")
+		}
+		if metadata.Diff(args[0], args[1], e.jsonOutput()) && *exitCode {
+			os.Exit(1)
+		}
+	}
+}
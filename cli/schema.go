@@ -0,0 +1,115 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Commands generating table schema and database JSON files, used by qserv-ingest
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/fjammes/qserv-tools/v2/database"
+	"github.com/fjammes/qserv-tools/v2/schema"
+
+	"github.com/rs/zerolog/log"
+)
+
+func schemaCommand() *command {
+	return &command{
+		name:       "schema",
+		summary:    "Generate Qserv table schema JSON files",
+		defaultSub: "generate",
+		subcommands: []*command{
+			{name: "generate", summary: "Generate table schemas from a Felis data model, a SQL DDL or a CSV file", setup: schemaGenerate},
+		},
+	}
+}
+
+func databaseCommand() *command {
+	return &command{
+		name:       "database",
+		summary:    "Generate database.json file",
+		defaultSub: "generate",
+		subcommands: []*command{
+			{name: "generate", summary: "Generate database.json, with the partitioning parameters of a database family", setup: databaseGenerate},
+		},
+	}
+}
+
+func schemaGenerate(flags *flag.FlagSet, e *env) func(args []string) {
+	felisFile := flags.String("felis", "", "Path to a Felis YAML data model")
+	ddlFile := flags.String("ddl", "", "Path to a SQL file containing CREATE TABLE statements")
+	csvFile := flags.String("csv", "", "Path to a CSV file with a header")
+	tableName := flags.String("table", "", "Name of the table created from CSV file, defaults to the file name")
+	delimiter := flags.String("delimiter", ",", "Field delimiter of the CSV file")
+	sampleSize := flags.Int("sample", 1000, "Number of CSV rows used to infer column types, 0 for all rows")
+	outDir := flags.String("out", "/tmp", "Path to output directory for table schemas")
+	idxDir := flags.String("idx", "", "Path to output directory for index configuration files, disabled if empty")
+	dbName := flags.String("database", "", "Name of the database, defaults to the Felis data model name")
+	directorsStr := flags.String("directors", "", "Comma separated names of the director tables of the Felis data model")
+	return func(args []string) {
+		switch {
+		case *felisFile != "":
+			var directors []string
+			if *directorsStr != "" {
+				directors = strings.Split(*directorsStr, ",")
+			}
+			schema.FelisCmd(*felisFile, *outDir, *idxDir, *dbName, directors)
+		case *ddlFile != "":
+			schema.DDLCmd(*ddlFile, *outDir, *dbName)
+		case *csvFile != "":
+			sep := []rune(*delimiter)
+			if len(sep) != 1 {
+				log.Fatal().Str("Delimiter", *delimiter).Msg("Error: delimiter must be a single character")
+			}
+			schema.CSVCmd(*csvFile, *outDir, *tableName, *dbName, sep[0], *sampleSize)
+		default:
+			log.Fatal().Msg("Error: one of --felis, --ddl or --csv is required")
+		}
+	}
+}
+
+// databaseGenerate writes database.json. The configuration of the replication controller is given
+// with -replication-config, -config being the configuration file of the tools
+func databaseGenerate(flags *flag.FlagSet, e *env) func(args []string) {
+	outFile := flags.String("out", "/tmp/database.json", "Path to output file")
+	cfg := database.Config{}
+	flags.StringVar(&cfg.Database, "database", "", "Name of the database")
+	flags.StringVar(&cfg.AuthKey, "auth_key", "", "Authorization key of the replication controller")
+	flags.IntVar(&cfg.NumStripes, "num_stripes", 0, fmt.Sprintf("Number of stripes, defaults to %d", database.DefaultNumStripes))
+	flags.IntVar(&cfg.NumSubStripes, "num_sub_stripes", 0, fmt.Sprintf("Number of sub-stripes, defaults to %d", database.DefaultNumSubStripes))
+	overlap := flags.Float64("overlap", database.DefaultOverlap, "Overlap in degrees")
+	flags.StringVar(&cfg.Family, "family", "", "Read partitioning parameters from this database family")
+	flags.StringVar(&cfg.ReplicationConfig, "replication-config", "", "Path to replication controller configuration, required by --family")
+	flags.BoolVar(&cfg.AutoBuildSecondaryIndex, "auto_build_secondary_index", true, "Build secondary index automatically")
+	flags.BoolVar(&cfg.LocalLoadSecondaryIndex, "local_load_secondary_index", true, "Load secondary index locally")
+	return func(args []string) {
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "overlap" {
+				cfg.Overlap = overlap
+			}
+		})
+		database.Cmd(*outFile, cfg)
+	}
+}
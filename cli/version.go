@@ -0,0 +1,100 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Command printing the version of the tools and the revision they were built from
+
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/rs/zerolog/log"
+)
+
+// version is set at build time:
+// go build -ldflags "-X github.com/fjammes/qserv-tools/v2/cli.version=v2.1.0" ./cmd/qserv-tools
+var version = "dev"
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// readBuildInfo returns the version and the VCS information recorded by the Go toolchain
+func readBuildInfo() buildInfo {
+	info := buildInfo{Version: version, GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.Time = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+func versionCommand() *command {
+	return &command{
+		name:    "version",
+		summary: "Print the version of the tools",
+		setup:   printVersion,
+	}
+}
+
+func printVersion(flags *flag.FlagSet, e *env) func(args []string) {
+	return func(args []string) {
+		info := readBuildInfo()
+		if e.jsonOutput() {
+			content, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				log.Fatal().Err(err).Msg("Error while writing version")
+			}
+			fmt.Println(string(content))
+			return
+		}
+		fmt.Printf("%s %s %s", programName, info.Version, info.GoVersion)
+		if info.Revision != "" {
+			fmt.Printf(" revision %s %s", info.Revision, info.Time)
+			if info.Modified {
+				fmt.Printf(" (modified)")
+			}
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,38 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Print the effective configuration of the tools
+// Deprecated: kept for compatibility, run 'qserv-tools config show' instead
+// Exemple to run it:
+// go run cmd/config/main.go show --config ~/.config/qserv-tools/config.yaml --profile local
+
+package main
+
+import (
+	"os"
+
+	"github.com/fjammes/qserv-tools/v2/cli"
+)
+
+func main() {
+	cli.Main(append([]string{"config"}, os.Args[1:]...))
+}
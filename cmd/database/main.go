@@ -0,0 +1,50 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Generate database.json file, used by qserv-ingest
+// Deprecated: kept for compatibility, run 'qserv-tools database generate' instead
+// Exemple to run it:
+// go run cmd/database/main.go --database dp02_dc2_catalogs --family layout_340_3 --config cmd/ingest/response.json
+
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/fjammes/qserv-tools/v2/cli"
+)
+
+func main() {
+	// -config was the replication controller configuration, before the configuration file of the tools
+	args := []string{"database", "generate"}
+	for _, arg := range os.Args[1:] {
+		for _, prefix := range []string{"-config", "--config"} {
+			if arg == prefix || strings.HasPrefix(arg, prefix+"=") {
+				arg = "--replication-config" + strings.TrimPrefix(arg, prefix)
+				break
+			}
+		}
+		args = append(args, arg)
+	}
+	cli.Main(args)
+}
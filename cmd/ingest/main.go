@@ -21,143 +21,16 @@
  */
 
 // Minimalist client for Qserv ingest API
+// Deprecated: kept for compatibility, run 'qserv-tools ingest' instead
 
 package main
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
-	"flag"
-	"fmt"
-	"io"
-	"path/filepath"
+	"os"
 
-	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
-	v1 "k8s.io/api/core/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
-	restclient "k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/tools/remotecommand"
-	"k8s.io/client-go/util/homedir"
+	"github.com/fjammes/qserv-tools/v2/cli"
 )
 
-// ExecCmd exec command on specific pod and wait the command's output.
-func ExecCmd(client kubernetes.Interface, config *restclient.Config, podName string, namespace string,
-	command string, stdout io.Writer, stderr io.Writer) error {
-	cmd := []string{
-		"sh",
-		"-c",
-		command,
-	}
-	req := client.CoreV1().RESTClient().Post().Resource("pods").Name(podName).
-		Namespace(namespace).SubResource("exec")
-	option := &v1.PodExecOptions{
-		Command: cmd,
-		Stdin:   false,
-		Stdout:  true,
-		Stderr:  true,
-	}
-	req.VersionedParams(
-		option,
-		scheme.ParameterCodec,
-	)
-	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
-	if err != nil {
-		return err
-	}
-	err = exec.StreamWithContext(context.Background(), remotecommand.StreamOptions{
-		Stdin:  nil,
-		Stdout: stdout,
-		Stderr: stderr,
-	})
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func main() {
-
-	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	debug := flag.Bool("debug", false, "sets log level to debug")
-	var kubeconfig *string
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-	flag.Parse()
-
-	// Default level for this example is info, unless debug flag is present
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	if *debug {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	}
-
-	// use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
-	if err != nil {
-		panic(err.Error())
-	}
-
-	// create the clientset
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		panic(err.Error())
-	}
-
-	// Examples for error handling:
-	// - Use helper functions like e.g. errors.IsNotFound()
-	// - And/or cast to StatusError and use its properties like e.g. ErrStatus.Message
-	namespace := "default"
-	podName := "qserv-repl-ctl-0"
-	// pod, err := clientset.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
-	// if errors.IsNotFound(err) {
-	// 	fmt.Printf("Pod %s in namespace %s not found\n", pod, namespace)
-	// } else if statusError, isStatus := err.(*errors.StatusError); isStatus {
-	// 	fmt.Printf("Error getting pod %s in namespace %s: %v\n",
-	// 		pod, namespace, statusError.ErrStatus.Message)
-	// } else if err != nil {
-	// 	panic(err.Error())
-	// } else {
-	// 	fmt.Printf("Found pod %s in namespace %s\n", pod, namespace)
-	// }
-	cmd := "curl http://qserv-repl-ctl:8080/replication/config -X GET  -H \"Content-Type: application/json\" -d \"{\\\"auth_key\\\":\\\"$PASSWORD\\\"}\""
-	log.Info().Str("Pod", podName).Str("Cmd", cmd).Msg("Launch command inside container")
-	outbuf := new(bytes.Buffer)
-	errbuf := new(bytes.Buffer)
-	err = ExecCmd(clientset, config, podName, namespace, cmd, outbuf, errbuf)
-	if err != nil {
-		panic(err.Error())
-	}
-	response := outbuf.Bytes()
-	if !json.Valid([]byte(response)) {
-		// handle the error here
-		log.Fatal().Msg("invalid JSON string")
-	}
-	var responseJson map[string]any
-	json.Unmarshal(response, &responseJson)
-	//fmt.Fprint(w, string(data))
-	log.Debug().Bytes("Error message", errbuf.Bytes()).Msg("Error message")
-
-	configdb := responseJson["config"].(map[string]any)
-
-	//fmt.Printf("%v\n", configdb["databases"])
-	if configdb["databases"] != nil {
-		databases := configdb["databases"].([]any)
-		for _, value := range databases {
-			db := value.(map[string]any)
-			dbname := db["database"]
-			dbfamily := db["family_name"]
-			is_published := db["is_published"]
-			fmt.Printf("database: %v family_name: %v is_published %v\n", dbname, dbfamily, is_published)
-		}
-	} else {
-		fmt.Printf("No database registered\n")
-	}
-
+	cli.Main(append([]string{"ingest"}, os.Args[1:]...))
 }
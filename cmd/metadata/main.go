@@ -20,47 +20,19 @@
 * see <http://www.lsstcorp.org/LegalNotices/>.
  */
 
-// Generate dbbench.ini file from Qserv integration tests's datasets
-// See qserv/itest_src/datasets/case<ID>/queries
+// Generate and check metadata.json file, used by qserv-ingest
+// Deprecated: kept for compatibility, run 'qserv-tools metadata' instead
 // Exemple to run it:
-// go run itest/examples/dbbench.go && cat /tmp/dbbench.ini
+// go run cmd/metadata/main.go --path itest/case01/ --idx itest/case01/idx
 
 package main
 
 import (
-	"flag"
-	"strings"
+	"os"
 
-	"github.com/fjammes/qserv-tools/v2/metadata"
-
-	"github.com/rs/zerolog"
+	"github.com/fjammes/qserv-tools/v2/cli"
 )
 
 func main() {
-
-	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	debug := flag.Bool("debug", false, "sets log level to debug")
-	defaultInputDir := "/sps/lsst/groups/qserv/dataloader/stable/idf-dp0.2-catalog-chunked/PREOPS-905"
-	defaultIdxDir := "/sps/lsst/groups/qserv/dataloader/stable/idf-dp0.2-catalog-chunked/PREOPS-905/in2p3/config_indexes"
-	defaultOutputFile := "/tmp/metadata.json"
-	defaultOrderedTables := "Object Source DiaObject DiaSource CcdVisit ForcedSource ForcedSourceOnDiaObject MatchesTruth Visit"
-	inputDir := flag.String("path", defaultInputDir, "Path to input data")
-	outFile := flag.String("out", defaultOutputFile, "Path to output file")
-	idxDir := flag.String("idx", defaultIdxDir, "Path to indexes configuration files")
-	orderedTablesStr := flag.String("o", defaultOrderedTables, "Ingest order for tables")
-	flag.Parse()
-
-	// Default level for this example is info, unless debug flag is present
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	if *debug {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	}
-
-	cfg := metadata.Config{
-		DbJsonFile:    "dp02_dc2_catalogs.json",
-		OrderedTables: strings.Fields(*orderedTablesStr),
-		IdxDir:        *idxDir,
-	}
-
-	metadata.Cmd(*inputDir, *outFile, cfg)
+	cli.Main(append([]string{"metadata"}, os.Args[1:]...))
 }
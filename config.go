@@ -1,5 +0,0 @@
-package qservtools
-
-func Config() string {
-	return "qserv-tools config"
-}
@@ -0,0 +1,399 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Layered configuration shared by the tools. Values are read from built-in defaults, then from a YAML
+// configuration file and one of its named profiles, then from environment variables, and command line
+// flags, whose defaults are the resulting values, override them.
+//
+// See config.example.yaml for a configuration file with a CC-IN2P3 profile.
+//
+// Each value can be overridden by an environment variable named QSERV_TOOLS_<SECTION>_<KEY>,
+// like QSERV_TOOLS_METADATA_PATH, lists being comma or space separated.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Prefix of the environment variables overriding configuration values
+const envPrefix = "QSERV_TOOLS_"
+
+// Environment variables locating the configuration file and selecting its profile
+const (
+	EnvFile    = envPrefix + "CONFIG"
+	EnvProfile = envPrefix + "PROFILE"
+)
+
+// Metadata configures cmd/metadata
+type Metadata struct {
+	// Path to input data, directory or tar archive
+	Path string `yaml:"path" json:"path"`
+	// Path to indexes configuration files
+	Idx string `yaml:"idx" json:"idx"`
+	// Path to the generated metadata.json file
+	Out string `yaml:"out" json:"out"`
+	// Name of the database JSON file
+	Db string `yaml:"db" json:"db"`
+	// Ingest order for tables
+	Order []string `yaml:"order" json:"order"`
+}
+
+// Ingest configures cmd/ingest
+type Ingest struct {
+	// Path to the kubeconfig file
+	Kubeconfig string `yaml:"kubeconfig" json:"kubeconfig"`
+	// Namespace and name of the replication controller pod
+	Namespace string `yaml:"namespace" json:"namespace"`
+	Pod       string `yaml:"pod" json:"pod"`
+	// URL of the replication controller, from inside its pod
+	URL string `yaml:"url" json:"url"`
+}
+
+// DBBench configures dbbench
+type DBBench struct {
+	// Path to Qserv source code
+	QservSrcPath string `yaml:"qserv_src_path" json:"qserv_src_path"`
+	// Test case to extract
+	CaseId string `yaml:"case_id" json:"case_id"`
+	// Path to dbbench output file
+	DbbenchConf string `yaml:"dbbench_conf" json:"dbbench_conf"`
+}
+
+// Config is the configuration of the tools, by section
+type Config struct {
+	Metadata Metadata `yaml:"metadata" json:"metadata"`
+	Ingest   Ingest   `yaml:"ingest" json:"ingest"`
+	DBBench  DBBench  `yaml:"dbbench" json:"dbbench"`
+}
+
+// Options locate the configuration file and select its profile
+type Options struct {
+	// Path to the configuration file, the default file being used if it exists when empty
+	File string
+	// Name of the profile, the profile of the configuration file being used if empty
+	Profile string
+}
+
+// file is the content of a configuration file
+type file struct {
+	Config   `yaml:",inline"`
+	Profile  string               `yaml:"profile"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+// origin describes where the configuration was read from
+type origin struct {
+	file    string
+	profile string
+	env     []string
+}
+
+// Defaults returns the built-in configuration
+func Defaults() Config {
+	return Config{
+		Metadata: Metadata{
+			Out: "/tmp/metadata.json",
+			Db:  "database.json",
+		},
+		Ingest: Ingest{
+			Kubeconfig: "~/.kube/config",
+			Namespace:  "default",
+			Pod:        "qserv-repl-ctl-0",
+			URL:        "http://qserv-repl-ctl:8080",
+		},
+		DBBench: DBBench{
+			QservSrcPath: "~/src/qserv",
+			CaseId:       "case01",
+			DbbenchConf:  "/tmp/dbbench.ini",
+		},
+	}
+}
+
+// DefaultFile returns the path of the default configuration file, like ~/.config/qserv-tools/config.yaml
+func DefaultFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "qserv-tools", "config.yaml")
+}
+
+// ParseOptions reads the -config and -profile options from command line arguments, before flags are parsed,
+// or from the QSERV_TOOLS_CONFIG and QSERV_TOOLS_PROFILE environment variables
+func ParseOptions(args []string) Options {
+	opts := Options{File: os.Getenv(EnvFile), Profile: os.Getenv(EnvProfile)}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if name == arg {
+			continue
+		}
+		name, value, hasValue := strings.Cut(name, "=")
+		if name != "config" && name != "profile" {
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				continue
+			}
+			i++
+			value = args[i]
+		}
+		if name == "config" {
+			opts.File = value
+		} else {
+			opts.Profile = value
+		}
+	}
+	return opts
+}
+
+// AddFlags adds the -config and -profile flags to flags, so that they are accepted and documented,
+// their values being read by ParseOptions
+func AddFlags(flags *flag.FlagSet) {
+	flags.String("config", "", fmt.Sprintf("Path to the configuration file, defaults to $%s or %s", EnvFile, DefaultFile()))
+	flags.String("profile", "", fmt.Sprintf("Profile of the configuration file, defaults to $%s or to the profile of the file", EnvProfile))
+}
+
+// decodeStrict decodes YAML content into v, unknown keys being errors
+func decodeStrict(content []byte, v interface{}) error {
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// readFile overrides cfg with the values of a configuration file and of a profile, the profile
+// of the file being used if profile is empty, and returns the name of the applied profile
+func readFile(cfg *Config, path string, profile string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	f := file{Config: *cfg}
+	if err := decodeStrict(content, &f); err != nil {
+		return "", err
+	}
+	if profile == "" {
+		profile = f.Profile
+	}
+	if profile != "" {
+		node, ok := f.Profiles[profile]
+		if !ok {
+			names := make([]string, 0, len(f.Profiles))
+			for name := range f.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return "", fmt.Errorf("unknown profile %q, available profiles: %s", profile, strings.Join(names, ", "))
+		}
+		// Re-encode the profile so that its unknown keys are detected
+		content, err := yaml.Marshal(&node)
+		if err != nil {
+			return "", err
+		}
+		if err := decodeStrict(content, &f.Config); err != nil {
+			return "", fmt.Errorf("in profile %q: %v", profile, err)
+		}
+	}
+	*cfg = f.Config
+	return profile, nil
+}
+
+// envName returns the environment variable overriding the value of key in section
+func envName(section string, key string) string {
+	return envPrefix + strings.ToUpper(section+"_"+key)
+}
+
+// yamlKey returns the YAML key of a struct field
+func yamlKey(field reflect.StructField) string {
+	key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return key
+}
+
+// applyEnv overrides cfg with environment variables, and returns the names of the applied variables
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) ([]string, error) {
+	var applied []string
+	sections := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := yamlKey(sections.Type().Field(i))
+		values := sections.Field(i)
+		for j := 0; j < values.NumField(); j++ {
+			name := envName(section, yamlKey(values.Type().Field(j)))
+			s, ok := lookup(name)
+			if !ok {
+				continue
+			}
+			v := values.Field(j)
+			switch v.Kind() {
+			case reflect.String:
+				v.SetString(s)
+			case reflect.Int:
+				n, err := strconv.Atoi(s)
+				if err != nil {
+					return nil, fmt.Errorf("in variable %s: %v", name, err)
+				}
+				v.SetInt(int64(n))
+			case reflect.Bool:
+				b, err := strconv.ParseBool(s)
+				if err != nil {
+					return nil, fmt.Errorf("in variable %s: %v", name, err)
+				}
+				v.SetBool(b)
+			case reflect.Slice:
+				v.Set(reflect.ValueOf(strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })))
+			}
+			applied = append(applied, name)
+		}
+	}
+	return applied, nil
+}
+
+// expandHome replaces a leading ~/ with the home directory in the string values of cfg
+func expandHome(cfg *Config) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	sections := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		values := sections.Field(i)
+		for j := 0; j < values.NumField(); j++ {
+			v := values.Field(j)
+			if v.Kind() == reflect.String && strings.HasPrefix(v.String(), "~/") {
+				v.SetString(filepath.Join(home, v.String()[2:]))
+			}
+		}
+	}
+}
+
+// load returns the configuration selected by opts, and where it was read from
+func load(opts Options, lookup func(string) (string, bool)) (Config, origin, error) {
+	cfg := Defaults()
+	var o origin
+	path := opts.File
+	if path == "" {
+		if _, err := os.Stat(DefaultFile()); err == nil {
+			path = DefaultFile()
+		}
+	}
+	if path == "" && opts.Profile != "" {
+		return cfg, o, fmt.Errorf("profile %q requires a configuration file", opts.Profile)
+	}
+	if path != "" {
+		profile, err := readFile(&cfg, path, opts.Profile)
+		if err != nil {
+			return cfg, o, fmt.Errorf("in file %q: %v", path, err)
+		}
+		o.file = path
+		o.profile = profile
+	}
+	env, err := applyEnv(&cfg, lookup)
+	if err != nil {
+		return cfg, o, err
+	}
+	o.env = env
+	expandHome(&cfg)
+	return cfg, o, nil
+}
+
+// Load returns the configuration selected by opts, environment variables overriding its values
+func Load(opts Options) (Config, error) {
+	cfg, _, err := load(opts, os.LookupEnv)
+	return cfg, err
+}
+
+// FromArgs returns the configuration selected by the -config and -profile options of command line arguments,
+// see ParseOptions, and exits on error
+func FromArgs(args []string) Config {
+	cfg, err := Load(ParseOptions(args))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error in configuration")
+	}
+	return cfg
+}
+
+// show writes the configuration as YAML, preceded by comments describing where it was read from,
+// or as JSON if jsonOutput is set
+func show(w io.Writer, cfg Config, o origin, jsonOutput bool) error {
+	if jsonOutput {
+		content, err := json.MarshalIndent(struct {
+			File        string   `json:"file"`
+			Profile     string   `json:"profile"`
+			Environment []string `json:"environment"`
+			Config      Config   `json:"config"`
+		}{o.file, o.profile, o.env, cfg}, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(content))
+		return err
+	}
+	file := o.file
+	if file == "" {
+		file = "none, built-in defaults"
+	}
+	fmt.Fprintf(w, "# Configuration file: %s\n", file)
+	if o.profile != "" {
+		fmt.Fprintf(w, "# Profile: %s\n", o.profile)
+	}
+	for _, name := range o.env {
+		fmt.Fprintf(w, "# Environment: %s\n", name)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Show prints the effective configuration selected by opts, with the configuration file,
+// the profile and the environment variables it was read from, in JSON if jsonOutput is set
+func Show(opts Options, jsonOutput bool) {
+	cfg, o, err := load(opts, os.LookupEnv)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error in configuration")
+	}
+	if err := show(os.Stdout, cfg, o, jsonOutput); err != nil {
+		log.Fatal().Err(err).Msg("Error while writing configuration")
+	}
+}
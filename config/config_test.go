@@ -0,0 +1,142 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `profile: cc
+metadata:
+  out: /tmp/meta.json
+profiles:
+  cc:
+    metadata:
+      path: /sps/data
+  local:
+    metadata:
+      path: /data
+      order: [Object, Source]
+    ingest:
+      namespace: qserv
+`
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func noEnv(string) (string, bool) {
+	return "", false
+}
+
+// TestLoad check values are overridden by the file, then by its profile, then by environment variables
+func TestLoad(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	cfg, o, err := load(Options{}, noEnv)
+	assert.NoError(t, err)
+	assert.Equal(t, "", o.file)
+	assert.Equal(t, Defaults().Metadata, cfg.Metadata)
+
+	path := writeConfig(t, testConfig)
+	cfg, o, err = load(Options{File: path}, noEnv)
+	assert.NoError(t, err)
+	assert.Equal(t, "cc", o.profile)
+	assert.Equal(t, "/sps/data", cfg.Metadata.Path)
+	assert.Equal(t, "/tmp/meta.json", cfg.Metadata.Out)
+	assert.Equal(t, Defaults().Metadata.Order, cfg.Metadata.Order)
+
+	env := map[string]string{"QSERV_TOOLS_METADATA_PATH": "/env", "QSERV_TOOLS_METADATA_ORDER": "Source, Object"}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	cfg, o, err = load(Options{File: path, Profile: "local"}, lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, "local", o.profile)
+	assert.Equal(t, []string{"QSERV_TOOLS_METADATA_PATH", "QSERV_TOOLS_METADATA_ORDER"}, o.env)
+	assert.Equal(t, "/env", cfg.Metadata.Path)
+	assert.Equal(t, []string{"Source", "Object"}, cfg.Metadata.Order)
+	assert.Equal(t, "qserv", cfg.Ingest.Namespace)
+	assert.Equal(t, "/tmp/meta.json", cfg.Metadata.Out)
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := writeConfig(t, testConfig)
+	_, _, err := load(Options{File: path, Profile: "unknown"}, noEnv)
+	assert.ErrorContains(t, err, "available profiles: cc, local")
+
+	_, _, err = load(Options{Profile: "cc"}, noEnv)
+	assert.Error(t, err, "A profile requires a configuration file")
+
+	path = writeConfig(t, "metadata:\n  pth: /data\n")
+	_, _, err = load(Options{File: path}, noEnv)
+	assert.ErrorContains(t, err, "field pth not found")
+
+	path = writeConfig(t, "profiles:\n  p:\n    ingest:\n      pods: x\n")
+	_, _, err = load(Options{File: path, Profile: "p"}, noEnv)
+	assert.ErrorContains(t, err, `in profile "p"`)
+
+	_, _, err = load(Options{File: filepath.Join(t.TempDir(), "missing.yaml")}, noEnv)
+	assert.Error(t, err)
+}
+
+func TestDefaultFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "qserv-tools"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "qserv-tools", "config.yaml"), []byte(testConfig), 0644))
+	cfg, o, err := load(Options{}, noEnv)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "qserv-tools", "config.yaml"), o.file)
+	assert.Equal(t, "/sps/data", cfg.Metadata.Path)
+}
+
+func TestParseOptions(t *testing.T) {
+	t.Setenv(EnvFile, "/env.yaml")
+	t.Setenv(EnvProfile, "")
+	assert.Equal(t, Options{File: "/env.yaml"}, ParseOptions([]string{"-debug"}))
+	assert.Equal(t, Options{File: "/a.yaml", Profile: "local"}, ParseOptions([]string{"--config", "/a.yaml", "-debug", "-profile=local"}))
+	assert.Equal(t, Options{File: "/env.yaml"}, ParseOptions([]string{"--", "-profile", "local"}))
+	assert.Equal(t, Options{File: "/env.yaml"}, ParseOptions([]string{"-profile"}))
+}
+
+func TestShow(t *testing.T) {
+	cfg := Defaults()
+	cfg.Metadata.Order = []string{"Object"}
+	var out bytes.Buffer
+	o := origin{file: "/a.yaml", profile: "cc", env: []string{"QSERV_TOOLS_INGEST_POD"}}
+	assert.NoError(t, show(&out, cfg, o, false))
+	assert.Contains(t, out.String(), "# Configuration file: /a.yaml\n# Profile: cc\n# Environment: QSERV_TOOLS_INGEST_POD\nmetadata:\n")
+	assert.Contains(t, out.String(), "  order:\n    - Object\n")
+
+	out.Reset()
+	assert.NoError(t, show(&out, cfg, o, true))
+	var shown struct {
+		Profile string `json:"profile"`
+		Config  Config `json:"config"`
+	}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &shown))
+	assert.Equal(t, "cc", shown.Profile)
+	assert.Equal(t, cfg, shown.Config)
+}
+
+// TestExampleFile check the profiles of config.example.yaml
+func TestExampleFile(t *testing.T) {
+	cfg, o, err := load(Options{File: "config.example.yaml", Profile: "cc-in2p3"}, noEnv)
+	assert.NoError(t, err)
+	assert.Equal(t, "cc-in2p3", o.profile)
+	assert.Equal(t, "dp02_dc2_catalogs.json", cfg.Metadata.Db)
+	assert.Equal(t, "Object", cfg.Metadata.Order[0])
+
+	cfg, _, err = load(Options{File: "config.example.yaml", Profile: "case01"}, noEnv)
+	assert.NoError(t, err)
+	assert.Equal(t, "itest/case01", cfg.Metadata.Path)
+	assert.Empty(t, cfg.Metadata.Order)
+}
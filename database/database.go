@@ -0,0 +1,177 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Generate database.json file from partitioning parameters
+// or from a database family of the replication controller configuration
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/fjammes/qserv-tools/v2/replication"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Default partitioning parameters used by Qserv
+const (
+	DefaultNumStripes    = 340
+	DefaultNumSubStripes = 3
+	DefaultOverlap       = 0.01667
+)
+
+// Database is the content of a database.json file
+type Database struct {
+	AuthKey                 string  `json:"auth_key"`
+	Database                string  `json:"database"`
+	AutoBuildSecondaryIndex int     `json:"auto_build_secondary_index"`
+	LocalLoadSecondaryIndex int     `json:"local_load_secondary_index"`
+	NumStripes              int     `json:"num_stripes"`
+	NumSubStripes           int     `json:"num_sub_stripes"`
+	Overlap                 float64 `json:"overlap"`
+}
+
+// Family is a database family of the replication controller configuration
+type Family = replication.Family
+
+type Config struct {
+	Database string
+	AuthKey  string
+	// Partitioning parameters, zero values are unset
+	NumStripes    int
+	NumSubStripes int
+	// Overlap is nil if unset, as an overlap of 0 is valid
+	Overlap *float64
+	// Name of a database family providing partitioning parameters
+	Family string
+	// Path to a replication controller configuration, as returned by /replication/config
+	ReplicationConfig       string
+	AutoBuildSecondaryIndex bool
+	LocalLoadSecondaryIndex bool
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// findFamily returns the database family named name in a replication controller configuration file
+func findFamily(configFile string, name string) (*Family, error) {
+	cfg, err := replication.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	family, ok := cfg.Family(name)
+	if !ok {
+		return nil, fmt.Errorf("database family %q not found in %q", name, configFile)
+	}
+	return family, nil
+}
+
+// New returns a database description built from partitioning parameters,
+// which are read from a database family if one is specified
+func New(cfg Config) (*Database, error) {
+	if cfg.Database == "" {
+		return nil, fmt.Errorf("database name is required")
+	}
+	db := Database{
+		AuthKey:                 cfg.AuthKey,
+		Database:                cfg.Database,
+		AutoBuildSecondaryIndex: boolToInt(cfg.AutoBuildSecondaryIndex),
+		LocalLoadSecondaryIndex: boolToInt(cfg.LocalLoadSecondaryIndex),
+		NumStripes:              cfg.NumStripes,
+		NumSubStripes:           cfg.NumSubStripes,
+		Overlap:                 DefaultOverlap,
+	}
+	if cfg.Overlap != nil {
+		db.Overlap = *cfg.Overlap
+	}
+
+	if cfg.Family != "" {
+		family, err := findFamily(cfg.ReplicationConfig, cfg.Family)
+		if err != nil {
+			return nil, err
+		}
+		if (cfg.NumStripes != 0 && cfg.NumStripes != family.NumStripes) ||
+			(cfg.NumSubStripes != 0 && cfg.NumSubStripes != family.NumSubStripes) ||
+			(cfg.Overlap != nil && *cfg.Overlap != family.Overlap) {
+			return nil, fmt.Errorf("partitioning parameters differ from database family %q", family.Name)
+		}
+		db.NumStripes = family.NumStripes
+		db.NumSubStripes = family.NumSubStripes
+		db.Overlap = family.Overlap
+	} else {
+		if db.NumStripes == 0 {
+			db.NumStripes = DefaultNumStripes
+		}
+		if db.NumSubStripes == 0 {
+			db.NumSubStripes = DefaultNumSubStripes
+		}
+	}
+
+	if db.NumStripes < 0 || db.NumSubStripes < 0 || db.Overlap < 0 {
+		return nil, fmt.Errorf("partitioning parameters must be positive")
+	}
+	return &db, nil
+}
+
+// Load reads a database.json file
+func Load(filename string) (*Database, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var db Database
+	err = json.Unmarshal(b, &db)
+	if err != nil {
+		return nil, fmt.Errorf("in file %q: %v", filename, err)
+	}
+	return &db, nil
+}
+
+// Cmd generates a database.json file
+func Cmd(outFile string, cfg Config) {
+
+	db, err := New(cfg)
+	if err != nil {
+		log.Fatal().AnErr("Database", err).Msg("Error while building database description")
+	}
+
+	log.Info().Str("Path", outFile).Str("Database", db.Database).Int("NumStripes", db.NumStripes).Int("NumSubStripes", db.NumSubStripes).Float64("Overlap", db.Overlap).Msg("Generate JSON file")
+
+	f, err := os.Create(outFile)
+	if err != nil {
+		log.Fatal().AnErr("Create", err).Msg("Error while creating output file")
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "    ")
+	err = enc.Encode(db)
+	if err != nil {
+		log.Fatal().AnErr("Encode", err).Msg("Error while writing output file")
+	}
+}
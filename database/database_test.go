@@ -0,0 +1,59 @@
+package database
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func srcDir() string {
+	_, filename, _, _ := runtime.Caller(0)
+	return filepath.Dir(filepath.Dir(filename))
+}
+
+// TestFindFamily check database families are read from a truncated replication controller response
+func TestFindFamily(t *testing.T) {
+	configFile := filepath.Join(srcDir(), "cmd", "ingest", "response.json")
+	family, err := findFamily(configFile, "layout_85_12")
+	assert.NoError(t, err)
+	assert.Equal(t, Family{Name: "layout_85_12", MinReplicationLevel: 1, NumStripes: 85, NumSubStripes: 12, Overlap: 0.01667}, *family)
+
+	_, err = findFamily(configFile, "unknown")
+	assert.Error(t, err)
+}
+
+// TestNew check database.New() against itest/case01/database.json
+func TestNew(t *testing.T) {
+	expected, err := Load(filepath.Join(srcDir(), "itest", "case01", "database.json"))
+	assert.NoError(t, err)
+
+	cfg := Config{
+		Database:                "qservTest_case01_qserv",
+		Family:                  "layout_85_12",
+		ReplicationConfig:       filepath.Join(srcDir(), "cmd", "ingest", "response.json"),
+		AutoBuildSecondaryIndex: true,
+		LocalLoadSecondaryIndex: true,
+	}
+	db, err := New(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, db)
+
+	cfg.NumStripes = 340
+	_, err = New(cfg)
+	assert.Error(t, err, "Partitioning parameters should not differ from family")
+
+	cfg.Family = ""
+	db, err = New(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 340, db.NumStripes)
+	assert.Equal(t, DefaultNumSubStripes, db.NumSubStripes)
+	assert.Equal(t, DefaultOverlap, db.Overlap)
+
+	overlap := 0.0
+	cfg.Overlap = &overlap
+	db, err = New(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, db.Overlap, "Overlap 0 should be kept")
+}
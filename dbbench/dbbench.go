@@ -23,14 +23,13 @@
 // Generate dbbench.ini file from Qserv integration tests's datasets
 // See qserv/itest_src/datasets/case<ID>/queries
 // Exemple to run it:
-// go run itest/examples/dbbench.go && cat /tmp/dbbench.ini
+// go run ./cmd/qserv-tools dbbench generate && cat /tmp/dbbench.ini
 
-package main
+package dbbench
 
 import (
 	"bufio"
 	"errors"
-	"flag"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
@@ -159,22 +158,19 @@ func generateCountQueries(filename string) (string, error) {
 	return out, nil
 }
 
-func main() {
+// Generate writes the dbbench configuration file of a Qserv integration test case to dbbench_conf, from
+// the queries and metadata.json file of its dataset in the Qserv source code
+func Generate(qserv_src_path string, case_id string, dbbench_conf string) {
 
 	var sqlFiles []fs.FileInfo
 
-	qserv_src_path := flag.String("qserv_src_path", "/home/fjammes/src/qserv/", "Path to Qserv source code")
-	case_id := flag.String("case_id", "case01", "Test case to extract")
-	dbbench_conf := flag.String("dbbench_conf", "/tmp/dbbench.ini", "Path to dbbench output file")
-	flag.Parse()
-
-	query_path := filepath.Join(*qserv_src_path, "itest_src", "datasets", *case_id, "queries")
-	metadata_path := filepath.Join(*qserv_src_path, "itest_src", "datasets", *case_id, "data", "ingest", "metadata.json")
+	query_path := filepath.Join(qserv_src_path, "itest_src", "datasets", case_id, "queries")
+	metadata_path := filepath.Join(qserv_src_path, "itest_src", "datasets", case_id, "data", "ingest", "metadata.json")
 
 	log.Printf("Use input queries  path %v", query_path)
 
-	conf_file := filepath.Join(*qserv_src_path, "src", "admin", "etc", "integration_tests.yaml")
-	skippedQueryIds, err := getSkippedQueries(conf_file, *case_id)
+	conf_file := filepath.Join(qserv_src_path, "src", "admin", "etc", "integration_tests.yaml")
+	skippedQueryIds, err := getSkippedQueries(conf_file, case_id)
 	check(err)
 
 	files, err := ioutil.ReadDir(query_path)
@@ -194,8 +190,8 @@ func main() {
 		}
 	}
 
-	log.Printf("Generate %s", *dbbench_conf)
-	f, err := os.Create(*dbbench_conf)
+	log.Printf("Generate %s", dbbench_conf)
+	f, err := os.Create(dbbench_conf)
 	check(err)
 
 	defer f.Close()
@@ -3,8 +3,11 @@ module github.com/fjammes/qserv-tools/v2
 go 1.18
 
 require (
+	github.com/cespare/xxhash/v2 v2.2.0
+	github.com/fsnotify/fsnotify v1.6.0
 	github.com/ohler55/ojg v1.15.0
 	github.com/rs/zerolog v1.27.0
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.0
 	github.com/stretchr/testify v1.8.0
 	golang.org/x/exp v0.0.0-20220613132600-b0d781184e0d
 	gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,187 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Minimalist client for Qserv replication controller, reached from inside its pod
+
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/fjammes/qserv-tools/v2/replication"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// Controller locates the replication controller
+type Controller struct {
+	// Path to the kubeconfig file
+	Kubeconfig string
+	// Namespace and name of the replication controller pod
+	Namespace string
+	Pod       string
+	// URL of the replication controller, from inside its pod
+	URL string
+}
+
+// databaseStatus is a database registered in the replication controller
+type databaseStatus struct {
+	Database  string `json:"database"`
+	Family    string `json:"family_name"`
+	Published int    `json:"is_published"`
+}
+
+// ExecCmd exec command on specific pod and wait the command's output.
+func ExecCmd(client kubernetes.Interface, config *restclient.Config, podName string, namespace string,
+	command string, stdout io.Writer, stderr io.Writer) error {
+	cmd := []string{
+		"sh",
+		"-c",
+		command,
+	}
+	req := client.CoreV1().RESTClient().Post().Resource("pods").Name(podName).
+		Namespace(namespace).SubResource("exec")
+	option := &v1.PodExecOptions{
+		Command: cmd,
+		Stdin:   false,
+		Stdout:  true,
+		Stderr:  true,
+	}
+	req.VersionedParams(
+		option,
+		scheme.ParameterCodec,
+	)
+	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+	err = exec.StreamWithContext(context.Background(), remotecommand.StreamOptions{
+		Stdin:  nil,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// fetchConfig returns the configuration of the replication controller, read with curl inside its pod
+func (c Controller) fetchConfig() ([]byte, error) {
+	// use the current context in kubeconfig
+	restConfig, err := clientcmd.BuildConfigFromFlags("", c.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// create the clientset
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := fmt.Sprintf("curl %s/replication/config -X GET  -H \"Content-Type: application/json\" -d \"{\\\"auth_key\\\":\\\"$PASSWORD\\\"}\"", c.URL)
+	log.Info().Str("Pod", c.Pod).Str("Cmd", cmd).Msg("Launch command inside container")
+	outbuf := new(bytes.Buffer)
+	errbuf := new(bytes.Buffer)
+	err = ExecCmd(clientset, restConfig, c.Pod, c.Namespace, cmd, outbuf, errbuf)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Bytes("Error message", errbuf.Bytes()).Msg("Error message")
+	return outbuf.Bytes(), nil
+}
+
+// parseConfig decodes the configuration of the replication controller, logging the entries
+// which were skipped
+func parseConfig(response []byte) (*replication.Config, error) {
+	cfg, err := replication.Parse(response)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Truncated {
+		log.Warn().Msg("Replication controller configuration is truncated, only its complete entries are read")
+	}
+	for _, w := range cfg.Warnings {
+		log.Warn().Str("Entry", w).Msg("Replication controller configuration entry skipped")
+	}
+	return cfg, nil
+}
+
+// databases returns the databases registered in a replication controller configuration, which must not be truncated
+func databases(response []byte) ([]databaseStatus, error) {
+	cfg, err := parseConfig(response)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Truncated {
+		return nil, fmt.Errorf("response truncated, the list of databases would be incomplete")
+	}
+	var dbs []databaseStatus
+	for _, db := range cfg.Databases {
+		status := databaseStatus{Database: db.Database, Family: db.Family}
+		if db.IsPublished {
+			status.Published = 1
+		}
+		dbs = append(dbs, status)
+	}
+	return dbs, nil
+}
+
+// Databases prints the databases registered in the replication controller, in JSON if jsonOutput is set
+func Databases(c Controller, jsonOutput bool) {
+	response, err := c.fetchConfig()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error while reading replication controller configuration")
+	}
+	dbs, err := databases(response)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error while reading replication controller configuration")
+	}
+	if jsonOutput {
+		if dbs == nil {
+			dbs = []databaseStatus{}
+		}
+		content, err := json.MarshalIndent(dbs, "", "  ")
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error while writing databases")
+		}
+		fmt.Println(string(content))
+		return
+	}
+	if len(dbs) == 0 {
+		fmt.Printf("No database registered\n")
+	}
+	for _, db := range dbs {
+		fmt.Printf("database: %v family_name: %v is_published %v\n", db.Database, db.Family, db.Published)
+	}
+}
@@ -0,0 +1,35 @@
+package ingest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabases(t *testing.T) {
+	response := `{"config":{"database_families":[{"name":"layout_340_3"}],"databases":[
+		{"database":"dc2_run2_1i_dr1b","family_name":"layout_340_3","is_published":1,"tables":[]},
+		{"database":"dp02_dc2_catalogs","family_name":"layout_340_3","is_published":0}]}}`
+	dbs, err := databases([]byte(response))
+	assert.NoError(t, err)
+	assert.Equal(t, []databaseStatus{
+		{Database: "dc2_run2_1i_dr1b", Family: "layout_340_3", Published: 1},
+		{Database: "dp02_dc2_catalogs", Family: "layout_340_3", Published: 0},
+	}, dbs)
+
+	dbs, err = databases([]byte(`{"config":{}}`))
+	assert.NoError(t, err)
+	assert.Empty(t, dbs)
+}
+
+// TestDatabasesResponse check databases are not listed from a truncated replication controller response
+func TestDatabasesResponse(t *testing.T) {
+	response, err := os.ReadFile("../cmd/ingest/response.json")
+	assert.NoError(t, err)
+	_, err = databases(response)
+	assert.ErrorContains(t, err, "truncated")
+
+	_, err = databases([]byte("Error from server: pod not found"))
+	assert.Error(t, err)
+}
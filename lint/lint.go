@@ -0,0 +1,318 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Validate metadata.json, table schema and database JSON files against JSON Schema documents embedded in the binary
+
+package lint
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+//go:embed schemas/*.schema.json
+var schemas embed.FS
+
+// Kind is the type of a JSON file read by qserv-ingest
+type Kind string
+
+const (
+	// KindMetadata is a metadata.json file, listing the data files of a database
+	KindMetadata Kind = "metadata"
+	// KindTable is a table schema JSON file
+	KindTable Kind = "table"
+	// KindDatabase is a database JSON file, with partitioning parameters
+	KindDatabase Kind = "database"
+)
+
+// Kinds are the supported file kinds
+var Kinds = []Kind{KindMetadata, KindTable, KindDatabase}
+
+// ParseKind checks a file kind, an empty string detecting the kind of each file
+func ParseKind(s string) (Kind, error) {
+	if s == "" {
+		return "", nil
+	}
+	for _, k := range Kinds {
+		if Kind(s) == k {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("unknown file kind %q, use metadata, table or database", s)
+}
+
+func schemaFile(kind Kind) string {
+	return fmt.Sprintf("schemas/%s.schema.json", kind)
+}
+
+// Schema returns the JSON Schema document of a file kind
+func Schema(kind Kind) ([]byte, error) {
+	return schemas.ReadFile(schemaFile(kind))
+}
+
+// compile compiles the JSON Schema document of a file kind
+func compile(kind Kind) (*jsonschema.Schema, error) {
+	content, err := Schema(kind)
+	if err != nil {
+		return nil, err
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(schemaFile(kind), bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	return c.Compile(schemaFile(kind))
+}
+
+// detectKind returns the kind of a file from its name, or from the keys of its top-level object
+func detectKind(path string, doc interface{}) (Kind, error) {
+	switch filepath.Base(path) {
+	case "metadata.json":
+		return KindMetadata, nil
+	case "database.json":
+		return KindDatabase, nil
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("unable to detect file kind, top-level value is not an object")
+	}
+	has := func(key string) bool {
+		_, ok := obj[key]
+		return ok
+	}
+	switch {
+	case has("tables"):
+		return KindMetadata, nil
+	case has("num_stripes"):
+		return KindDatabase, nil
+	case has("table") || has("is_partitioned"):
+		return KindTable, nil
+	}
+	return "", fmt.Errorf("unable to detect file kind, use a kind option")
+}
+
+// issue is a validation error located in a file
+type issue struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (i issue) String() string {
+	path := i.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", i.Line, i.Column, path, i.Message)
+}
+
+// position returns the line and column, starting at 1, of an offset in content
+func position(content []byte, offset int64) (int, int) {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	before := content[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// skipSeparators returns the offset of the first byte of content, from offset, which is not a blank or a separator
+func skipSeparators(content []byte, offset int64) int64 {
+	for offset < int64(len(content)) && strings.IndexByte(" \t\r\n:,", content[offset]) != -1 {
+		offset++
+	}
+	return offset
+}
+
+// escapeToken escapes a JSON pointer token, like instance locations of validation errors
+func escapeToken(token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	token = strings.ReplaceAll(token, "/", "~1")
+	return url.PathEscape(token)
+}
+
+// valueOffsets returns the offset in content of each JSON value, by JSON pointer
+func valueOffsets(content []byte) (map[string]int64, error) {
+	offsets := make(map[string]int64)
+	dec := json.NewDecoder(bytes.NewReader(content))
+	var walk func(ptr string) error
+	walk = func(ptr string) error {
+		offsets[ptr] = skipSeparators(content, dec.InputOffset())
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if err := walk(ptr + "/" + escapeToken(key.(string))); err != nil {
+					return err
+				}
+			}
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if err := walk(fmt.Sprintf("%s/%d", ptr, i)); err != nil {
+					return err
+				}
+			}
+		default:
+			return nil
+		}
+		// Closing delimiter
+		_, err = dec.Token()
+		return err
+	}
+	return offsets, walk("")
+}
+
+// leaves returns the validation errors without causes, which are the most precise
+func leaves(ve *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(ve.Causes) == 0 {
+		return []*jsonschema.ValidationError{ve}
+	}
+	var errs []*jsonschema.ValidationError
+	for _, c := range ve.Causes {
+		errs = append(errs, leaves(c)...)
+	}
+	return errs
+}
+
+// lint validates content against the schema of kind, or of its detected kind if empty,
+// and returns the detected kind and the validation errors, sorted by position
+func lint(path string, content []byte, kind Kind) (Kind, []issue, error) {
+	var doc interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		if serr, ok := err.(*json.SyntaxError); ok {
+			line, column := position(content, serr.Offset)
+			return kind, []issue{{Line: line, Column: column, Message: serr.Error()}}, nil
+		}
+		return kind, nil, err
+	}
+	if kind == "" {
+		var err error
+		if kind, err = detectKind(path, doc); err != nil {
+			return kind, nil, err
+		}
+	}
+	schema, err := compile(kind)
+	if err != nil {
+		return kind, nil, err
+	}
+	err = schema.Validate(doc)
+	if err == nil {
+		return kind, nil, nil
+	}
+	ve, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return kind, nil, err
+	}
+	offsets, err := valueOffsets(content)
+	if err != nil {
+		return kind, nil, err
+	}
+	var issues []issue
+	seen := make(map[issue]bool)
+	for _, leaf := range leaves(ve) {
+		line, column := position(content, offsets[leaf.InstanceLocation])
+		i := issue{Line: line, Column: column, Path: leaf.InstanceLocation, Message: leaf.Message}
+		if !seen[i] {
+			seen[i] = true
+			issues = append(issues, i)
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Column < issues[j].Column
+	})
+	return kind, issues, nil
+}
+
+// lintFile validates a file, see lint
+func lintFile(path string, kind Kind) (Kind, []issue, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return kind, nil, err
+	}
+	return lint(path, content, kind)
+}
+
+// fileReport is the result of the validation of a file
+type fileReport struct {
+	File   string  `json:"file"`
+	Kind   Kind    `json:"kind"`
+	Errors []issue `json:"errors"`
+}
+
+// Cmd validates files against the JSON Schema of kind, or of the kind detected for each file if empty,
+// and reports each error with its line, column and JSON pointer, in JSON if jsonOutput is set
+func Cmd(files []string, kind Kind, jsonOutput bool) {
+	invalid := 0
+	reports := make([]fileReport, 0, len(files))
+	for _, file := range files {
+		fileKind, issues, err := lintFile(file, kind)
+		if err != nil {
+			log.Fatal().Err(err).Str("File", file).Msg("Error while validating file")
+		}
+		if issues == nil {
+			issues = []issue{}
+		}
+		reports = append(reports, fileReport{File: file, Kind: fileKind, Errors: issues})
+		if !jsonOutput {
+			for _, i := range issues {
+				fmt.Printf("%s:%s\n", file, i)
+			}
+		}
+		if len(issues) != 0 {
+			invalid++
+			log.Error().Str("File", file).Str("Kind", string(fileKind)).Int("Errors", len(issues)).Msg("Invalid file")
+		} else {
+			log.Info().Str("File", file).Str("Kind", string(fileKind)).Msg("Valid file")
+		}
+	}
+	if jsonOutput {
+		content, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error while writing validation report")
+		}
+		fmt.Println(string(content))
+	}
+	if invalid != 0 {
+		log.Fatal().Int("Files", invalid).Msg("Error: invalid files")
+	}
+}
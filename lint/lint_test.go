@@ -0,0 +1,89 @@
+package lint
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLintValid check the files of the integration test and of the benchmark are valid
+func TestLintValid(t *testing.T) {
+	files, err := filepath.Glob("../itest/case01/*.json")
+	assert.NoError(t, err)
+	files = append(files, "../dbbench/metadata.json")
+	kinds := make(map[Kind]int)
+	for _, file := range files {
+		kind, issues, err := lintFile(file, "")
+		assert.NoError(t, err)
+		assert.Empty(t, issues, file)
+		kinds[kind]++
+	}
+	assert.Equal(t, map[Kind]int{KindMetadata: 2, KindDatabase: 1, KindTable: 8}, kinds)
+}
+
+func TestLintInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		kind    Kind
+		want    []string
+	}{
+		{
+			name: "metadata.json",
+			content: `{
+  "database": "database.json",
+  "tables": [
+    {"schema": "Object.json", "data": [{"directory": "a/", "chunks": [1, -2], "files": ["x"]}]},
+    {"schema": "Source", "data": [], "extra": 1}
+  ]
+}`,
+			want: []string{
+				"4:74: /tables/0/data/0/chunks/1: must be >= 0 but found -2",
+				"4:88: /tables/0/data/0/files: not allowed",
+				"5:5: /tables/1: additionalProperties 'extra' not allowed",
+				"5:16: /tables/1/schema: does not match pattern '\\\\.json$'",
+			},
+		},
+		{
+			name:    "Object.json",
+			content: `{"database": "d", "table": "Object", "is_partitioned": 1, "director_key": "", "schema": [{"name": "id"}]}`,
+			want: []string{
+				"1:1: /: missing properties: 'latitude_key', 'longitude_key'",
+				"1:75: /director_key: length must be >= 1, but got 0",
+				"1:90: /schema/0: missing properties: 'type'",
+			},
+		},
+		{
+			name:    "db.json",
+			content: "{\"database\": \"d\",\n \"num_stripes\": \"85\", \"num_sub_stripes\": 12, \"overlap\": 0.01}",
+			kind:    KindDatabase,
+			want:    []string{"2:17: /num_stripes: expected integer, but got string"},
+		},
+		{
+			name:    "database.json",
+			content: "{\"database\": \"d\",\n \"num_stripes\": 85,",
+			want:    []string{"2:20: /: unexpected end of JSON input"},
+		},
+	}
+	for _, test := range tests {
+		_, issues, err := lint(test.name, []byte(test.content), test.kind)
+		assert.NoError(t, err, test.name)
+		var got []string
+		for _, i := range issues {
+			got = append(got, i.String())
+		}
+		assert.Equal(t, test.want, got, test.name)
+	}
+}
+
+func TestDetectKind(t *testing.T) {
+	kind, err := detectKind("Object.json", map[string]interface{}{"table": "Object"})
+	assert.NoError(t, err)
+	assert.Equal(t, KindTable, kind)
+	kind, err = detectKind("meta.json", map[string]interface{}{"tables": []interface{}{}})
+	assert.NoError(t, err)
+	assert.Equal(t, KindMetadata, kind)
+	_, err = detectKind("idx.json", map[string]interface{}{"index": "i"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,274 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Read chunk contribution files from tar archives, with or without gzip compression
+
+package metadata
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// archiveEntry describes a regular file stored inside a tar archive
+type archiveEntry struct {
+	// path relative to the archive root directory
+	rpath string
+	size  int64
+}
+
+// isArchive returns true if inputPath is a regular file with a tar extension
+func isArchive(inputPath string) bool {
+	info, err := os.Stat(inputPath)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(inputPath, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// openArchive returns a tar reader on archive, transparently handling gzip compression,
+// and a function to close underlying files
+func openArchive(archive string) (*tar.Reader, func(), error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	br := bufio.NewReader(f)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		f.Close()
+		return nil, nil, err
+	}
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("in archive %q: %v", archive, err)
+		}
+		closer := func() {
+			gz.Close()
+			f.Close()
+		}
+		return tar.NewReader(gz), closer, nil
+	}
+	return tar.NewReader(br), func() { f.Close() }, nil
+}
+
+// archiveRelPath returns the path of a tar entry relative to root,
+// and false if the entry is outside of root
+func archiveRelPath(name string, root string) (string, bool) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	root = strings.Trim(path.Clean("/"+root), "/")
+	if root == "" {
+		return name, name != ""
+	}
+	if !strings.HasPrefix(name, root+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(name, root+"/"), true
+}
+
+// archiveFile returns the path relative to root of a regular file entry, and false for other entries
+// or entries outside of root. Links are rejected, as their target would be missing from the data
+func archiveFile(hdr *tar.Header, root string) (string, bool, error) {
+	rpath, ok := archiveRelPath(hdr.Name, root)
+	if !ok {
+		return "", false, nil
+	}
+	switch hdr.Typeflag {
+	case tar.TypeReg:
+		return rpath, true, nil
+	case tar.TypeSymlink, tar.TypeLink:
+		return "", false, fmt.Errorf("link %q to %q is not supported, archive the file itself", hdr.Name, hdr.Linkname)
+	}
+	return "", false, nil
+}
+
+// listArchive returns the regular files located under root inside archive,
+// in the order used by filepath.WalkDir on the unpacked tree
+func listArchive(archive string, root string) ([]archiveEntry, error) {
+	tr, closer, err := openArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	var entries []archiveEntry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("in archive %q: %v", archive, err)
+		}
+		rpath, ok, err := archiveFile(hdr, root)
+		if err != nil {
+			return nil, fmt.Errorf("in archive %q: %v", archive, err)
+		}
+		if !ok {
+			continue
+		}
+		entries = append(entries, archiveEntry{rpath: rpath, size: hdr.Size})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return walkLess(entries[i].rpath, entries[j].rpath)
+	})
+	return entries, nil
+}
+
+// walkLess compares two slash-separated paths component by component,
+// which reproduces the lexical order of filepath.WalkDir
+func walkLess(a string, b string) bool {
+	pa := strings.Split(a, "/")
+	pb := strings.Split(b, "/")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if pa[i] != pb[i] {
+			return pa[i] < pb[i]
+		}
+	}
+	return len(pa) < len(pb)
+}
+
+// walkArchive is the equivalent of walkDirs for a tar archive, cfg.ArchiveRoot being
+// the directory inside the archive which contains the table directories
+func walkArchive(archive string, cfg Config) TableMap {
+	var tables TableMap = make(map[string]DataSpec)
+	filter := newFileFilter(cfg)
+	tpl, err := newPathTemplate(cfg)
+	if err != nil {
+		log.Fatal().AnErr("Template", err).Msg("Error in configuration")
+	}
+
+	log.Info().Str("Archive", archive).Str("Root", cfg.ArchiveRoot).Msg("Add data files")
+	entries, err := listArchive(archive, cfg.ArchiveRoot)
+	if err != nil {
+		log.Fatal().AnErr("ListArchive", err).Msg("Error while scanning archive")
+	}
+	for _, entry := range entries {
+		loc, err := locate(entry.rpath, tpl)
+		ok := false
+		if err == nil {
+			ok, err = filter.accept(entry.rpath, loc.ftype)
+		}
+		if err == nil && ok {
+			err = addLocatedFile(tables, archive+":"+entry.rpath, loc)
+		}
+		if err != nil {
+			log.Fatal().AnErr("ListArchive", err).Msg("Error while scanning archive")
+		}
+	}
+	filter.logSummary()
+
+	err = addIndexes(tables, cfg.IdxDir)
+	if err != nil {
+		log.Fatal().AnErr("WalkDir", err).Msg("Error while scanning path")
+	}
+	return tables
+}
+
+// extractArchive unpacks the files located under root inside archive into targetDir,
+// a truncated archive being reported by the tar reader as an unexpected end of file
+func extractArchive(archive string, root string, targetDir string) error {
+	tr, closer, err := openArchive(archive)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("in archive %q: %v", archive, err)
+		}
+		rpath, ok, err := archiveFile(hdr, root)
+		if err != nil {
+			return fmt.Errorf("in archive %q: %v", archive, err)
+		}
+		if !ok {
+			continue
+		}
+		dest := filepath.Join(targetDir, filepath.FromSlash(rpath))
+		err = os.MkdirAll(filepath.Dir(dest), 0755)
+		if err != nil {
+			return err
+		}
+		log.Debug().Str("File", dest).Msg("Extract file")
+		err = writeFile(dest, tr)
+		if err != nil {
+			return fmt.Errorf("in archive %q: %v", archive, err)
+		}
+	}
+	return nil
+}
+
+// writeFile copies r into a new file
+func writeFile(dest string, r io.Reader) error {
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, r)
+	if err != nil {
+		return fmt.Errorf("while writing %q: %v", dest, err)
+	}
+	return f.Close()
+}
+
+// Extract unpacks archive into targetDir and checks that the extracted tree
+// produces the same metadata as the archive listing
+func Extract(archive string, targetDir string, cfg Config) {
+
+	log.Info().Str("Archive", archive).Str("Path", targetDir).Msg("Extract archive")
+	err := extractArchive(archive, cfg.ArchiveRoot, targetDir)
+	if err != nil {
+		log.Fatal().AnErr("Extract", err).Msg("Error while extracting archive")
+	}
+
+	log.Info().Str("Path", targetDir).Msg("Check extracted data")
+	archived := walkArchive(archive, cfg)
+	extracted := walkDirs(targetDir, cfg)
+	if !reflect.DeepEqual(archived, extracted) {
+		log.Fatal().Str("Archive", archive).Str("Path", targetDir).Msg("Error: extracted data differ from archive content")
+	}
+}
@@ -0,0 +1,138 @@
+package metadata
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testDataDir() string {
+	_, filename, _, _ := runtime.Caller(0)
+	srcDir := filepath.Dir(filepath.Dir(filename))
+	return filepath.Join(srcDir, "itest", "case01")
+}
+
+// createArchive writes a gzipped tar archive of srcDir, with entries prefixed by prefix
+func createArchive(t *testing.T, srcDir string, prefix string) string {
+	archive := filepath.Join(t.TempDir(), "case01.tar.gz")
+	f, err := os.Create(archive)
+	assert.NoError(t, err)
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	err = filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rpath, _ := filepath.Rel(srcDir, path)
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = prefix + filepath.ToSlash(rpath)
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return archive
+}
+
+// TestWalkArchive check metadata.walkArchive() returns the same tables as metadata.walkDirs()
+func TestWalkArchive(t *testing.T) {
+	testDir := testDataDir()
+	idxDir := filepath.Join(testDir, "idx")
+	archive := createArchive(t, testDir, "./case01/")
+
+	assert.True(t, isArchive(archive))
+	assert.False(t, isArchive(testDir))
+
+	expected := walkDirs(testDir, Config{IdxDir: idxDir})
+	tables := walkArchive(archive, Config{ArchiveRoot: "case01", IdxDir: idxDir})
+	assert.Equal(t, expected, tables, "Archive and directory should produce the same tables.")
+}
+
+// TestExtract check metadata.Extract() unpacks the data files of an archive
+func TestExtract(t *testing.T) {
+	testDir := testDataDir()
+	archive := createArchive(t, testDir, "case01/")
+	targetDir := t.TempDir()
+	cfg := Config{
+		IdxDir:      filepath.Join(testDir, "idx"),
+		ArchiveRoot: "case01",
+	}
+	Extract(archive, targetDir, cfg)
+
+	expected, err := os.ReadFile(filepath.Join(testDir, "Object", "DIR1", "chunk_6630.txt"))
+	assert.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(targetDir, "Object", "DIR1", "chunk_6630.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, content)
+}
+
+// writeTar writes a tar archive containing a regular file and an optional symbolic link
+func writeTar(t *testing.T, content string, link bool) string {
+	archive := filepath.Join(t.TempDir(), "data.tar")
+	f, err := os.Create(archive)
+	assert.NoError(t, err)
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "Object/chunk_1.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}))
+	_, err = tw.Write([]byte(content))
+	assert.NoError(t, err)
+	if link {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "Object/chunk_2.txt", Typeflag: tar.TypeSymlink, Linkname: "/data/chunk_2.txt"}))
+	}
+	assert.NoError(t, tw.Close())
+	return archive
+}
+
+// TestExtractErrors check truncated archives and links are reported
+func TestExtractErrors(t *testing.T) {
+	archive := writeTar(t, "1,2\n", false)
+	assert.NoError(t, extractArchive(archive, "", t.TempDir()))
+
+	content, err := os.ReadFile(archive)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(archive, content[:512+2], 0644))
+	assert.ErrorContains(t, extractArchive(archive, "", t.TempDir()), "unexpected EOF")
+
+	archive = writeTar(t, "1,2\n", true)
+	assert.ErrorContains(t, extractArchive(archive, "", t.TempDir()), "not supported")
+	_, err = listArchive(archive, "")
+	assert.ErrorContains(t, err, "not supported")
+}
+
+// TestArchiveRelPath check entries outside of the archive root are rejected
+func TestArchiveRelPath(t *testing.T) {
+	rpath, ok := archiveRelPath("./case01/Object/chunk_1.txt", "case01/")
+	assert.True(t, ok)
+	assert.Equal(t, "Object/chunk_1.txt", rpath)
+
+	_, ok = archiveRelPath("other/Object/chunk_1.txt", "case01")
+	assert.False(t, ok)
+
+	rpath, ok = archiveRelPath("../../etc/passwd", "")
+	assert.True(t, ok)
+	assert.Equal(t, "etc/passwd", rpath)
+}
@@ -0,0 +1,288 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Check rows of contribution files against table schemas before ingesting them
+
+package metadata
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fjammes/qserv-tools/v2/schema"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+)
+
+// Columns added by Qserv at ingest time, which are absent from contribution files
+var qservColumns = []string{"qserv_trans_id"}
+
+// Maximum length of a row in a contribution file
+const maxRowLength = 64 * 1024 * 1024
+
+// Maximum number of row errors reported for each file
+const maxFileErrors = 10
+
+// rowError describes a row which does not match its table schema
+type rowError struct {
+	rpath  string
+	line   int
+	column string
+	msg    string
+}
+
+// fileCheck is the result of checking one data file
+type fileCheck struct {
+	rows      int
+	errCount  int
+	rowErrors []rowError
+	// Number of invalid values for each column
+	columnErrors map[string]int
+	err          error
+}
+
+// splitFields splits a row on delimiter, a backslash escaping the next character like in LOAD DATA
+func splitFields(line []byte, delimiter byte) [][]byte {
+	fields := make([][]byte, 0, 16)
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case delimiter:
+			fields = append(fields, line[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, line[start:])
+}
+
+// fileDelimiter returns the field delimiter of a data file
+func fileDelimiter(ftype Filetype, cfg Config) byte {
+	switch ftype {
+	case Tsv:
+		return '\t'
+	case Csv:
+		return ','
+	}
+	if cfg.Delimiter != 0 {
+		return byte(cfg.Delimiter)
+	}
+	return ','
+}
+
+// dataColumns returns the columns of a table which are present in contribution files
+func dataColumns(t *schema.Table) []schema.Column {
+	var columns []schema.Column
+	for _, c := range t.Schema {
+		if !slices.Contains(qservColumns, c.Name) {
+			columns = append(columns, c)
+		}
+	}
+	return columns
+}
+
+// loadSchemas reads the schema JSON file of each table from schemaDir
+func loadSchemas(tables TableMap, schemaDir string) (map[string]*schema.Table, error) {
+	schemas := make(map[string]*schema.Table)
+	for tableName := range tables {
+		t, err := schema.Load(filepath.Join(schemaDir, tableName+".json"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to load schema for table %q: %v", tableName, err)
+		}
+		schemas[tableName] = t
+	}
+	return schemas, nil
+}
+
+// rowChecker returns an error message for an invalid row, and the invalid column if there is one
+type rowChecker func(fields [][]byte) (column string, msg string)
+
+// checkFile applies checkRow to each row of a data file, or to its first sampleRows rows if not 0
+func checkFile(path string, rpath string, delimiter byte, checkRow rowChecker, sampleRows int) fileCheck {
+	res := fileCheck{columnErrors: make(map[string]int)}
+	f, err := os.Open(path)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), maxRowLength)
+	for (sampleRows == 0 || res.rows < sampleRows) && sc.Scan() {
+		res.rows++
+		column, msg := checkRow(splitFields(sc.Bytes(), delimiter))
+		if msg != "" {
+			res.errCount++
+			if column != "" {
+				res.columnErrors[column]++
+			}
+			if len(res.rowErrors) < maxFileErrors {
+				res.rowErrors = append(res.rowErrors, rowError{rpath: rpath, line: res.rows, column: column, msg: msg})
+			}
+		}
+	}
+	res.err = sc.Err()
+	return res
+}
+
+// fieldCountChecker checks that rows have one field per data column
+func fieldCountChecker(t *schema.Table) rowChecker {
+	expected := len(dataColumns(t))
+	return func(fields [][]byte) (string, string) {
+		if len(fields) != expected {
+			return "", fmt.Sprintf("found %d fields, expected %d", len(fields), expected)
+		}
+		return "", ""
+	}
+}
+
+// valueChecker checks the field count of rows, and that each value can be loaded in its column
+func valueChecker(t *schema.Table) rowChecker {
+	columns := dataColumns(t)
+	types := make([]schema.ColumnType, len(columns))
+	var typeErr error
+	for i, c := range columns {
+		types[i], typeErr = schema.ParseType(c.Type)
+		if typeErr != nil {
+			break
+		}
+	}
+	checkCount := fieldCountChecker(t)
+	return func(fields [][]byte) (string, string) {
+		if typeErr != nil {
+			return "", typeErr.Error()
+		}
+		if column, msg := checkCount(fields); msg != "" {
+			return column, msg
+		}
+		for i, value := range fields {
+			err := types[i].Check(value)
+			if err != nil {
+				return columns[i].Name, err.Error()
+			}
+		}
+		return "", ""
+	}
+}
+
+// checkerFactory builds the row checker of a data file from its table schema
+type checkerFactory func(t *schema.Table, file dataFile) rowChecker
+
+// perTable returns a checker factory whose row checkers only depend on the table schema
+func perTable(newChecker func(t *schema.Table) rowChecker) checkerFactory {
+	return func(t *schema.Table, _ dataFile) rowChecker {
+		return newChecker(t)
+	}
+}
+
+// checkTables checks data files in parallel and returns the number of invalid rows or unreadable files
+func checkTables(inputDir string, files []dataFile, schemas map[string]*schema.Table, newChecker checkerFactory, cfg Config) int {
+	results := make([]fileCheck, len(files))
+	parallel(len(files), workers(cfg), func(i int) {
+		file := files[i]
+		checkRow := newChecker(schemas[file.table], file)
+		path := filepath.Join(inputDir, file.rpath)
+		results[i] = checkFile(path, file.rpath, fileDelimiter(file.ftype, cfg), checkRow, cfg.SampleRows)
+	})
+
+	type tableStats struct {
+		files, rows, errors int
+		columnErrors        map[string]int
+	}
+	stats := make(map[string]*tableStats)
+	errCount := 0
+	for i, res := range results {
+		table := files[i].table
+		if stats[table] == nil {
+			stats[table] = &tableStats{columnErrors: make(map[string]int)}
+		}
+		stats[table].files++
+		stats[table].rows += res.rows
+		stats[table].errors += res.errCount
+		for column, n := range res.columnErrors {
+			stats[table].columnErrors[column] += n
+		}
+		errCount += res.errCount
+		for _, e := range res.rowErrors {
+			log.Error().Str("Table", table).Str("File", e.rpath).Int("Line", e.line).Str("Column", e.column).Msg(e.msg)
+		}
+		if res.errCount > len(res.rowErrors) {
+			log.Error().Str("Table", table).Str("File", files[i].rpath).Int("Errors", res.errCount).Msg("Too many invalid rows, only first ones are reported")
+		}
+		if res.err != nil {
+			log.Error().Str("Table", table).Str("File", files[i].rpath).AnErr("Error", res.err).Msg("Unable to read file")
+			errCount++
+		}
+	}
+
+	tableNames := make([]string, 0, len(stats))
+	for table := range stats {
+		tableNames = append(tableNames, table)
+	}
+	sort.Strings(tableNames)
+	for _, table := range tableNames {
+		s := stats[table]
+		log.Info().Str("Table", table).Int("Files", s.files).Int("Rows", s.rows).Int("Errors", s.errors).Msg("Table checked")
+		columns := make([]string, 0, len(s.columnErrors))
+		for column := range s.columnErrors {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		for _, column := range columns {
+			log.Warn().Str("Table", table).Str("Column", column).Int("Errors", s.columnErrors[column]).Msg("Invalid values")
+		}
+	}
+	return errCount
+}
+
+// CheckData checks the number of fields, and optionally the values, of each row of the data files
+func CheckData(inputDir string, cfg Config) {
+
+	if isArchive(inputDir) {
+		log.Fatal().Str("Path", inputDir).Msg("Error: archives are not supported, use extraction first")
+	}
+	schemaDir := cfg.SchemaDir
+	if schemaDir == "" {
+		schemaDir = inputDir
+	}
+	log.Info().Str("Path", inputDir).Str("Schemas", schemaDir).Msg("Check data files")
+
+	tables := scan(inputDir, cfg)
+	schemas, err := loadSchemas(tables, schemaDir)
+	if err != nil {
+		log.Fatal().AnErr("Schema", err).Msg("Error while loading table schemas")
+	}
+	newChecker := perTable(fieldCountChecker)
+	if cfg.CheckValues {
+		newChecker = perTable(valueChecker)
+	}
+	errCount := checkTables(inputDir, dataFiles(tables), schemas, newChecker, cfg)
+	if errCount != 0 {
+		log.Fatal().Int("Errors", errCount).Msg("Error: invalid data files")
+	}
+	log.Info().Msg("All data files match table schemas")
+}
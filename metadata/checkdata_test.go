@@ -0,0 +1,74 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fjammes/qserv-tools/v2/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSplitFields check escaped delimiters do not split fields
+func TestSplitFields(t *testing.T) {
+	fields := splitFields([]byte(`1,a\,b,\N,`), ',')
+	assert.Equal(t, [][]byte{[]byte("1"), []byte(`a\,b`), []byte(`\N`), []byte("")}, fields)
+}
+
+// TestCheckTables check metadata.checkTables() on itest/case01 and on an invalid row
+func TestCheckTables(t *testing.T) {
+	testDir := testDataDir()
+	cfg := Config{Workers: 2}
+	tables := walkDirs(testDir, Config{})
+	schemas, err := loadSchemas(tables, testDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, checkTables(testDir, dataFiles(tables), schemas, perTable(fieldCountChecker), cfg))
+
+	inputDir := t.TempDir()
+	tables = writeTestTree(t, inputDir)
+	object := schema.Table{
+		Table: "Object",
+		Schema: []schema.Column{
+			{Name: "qserv_trans_id", Type: "INT NOT NULL"},
+			{Name: "objectId", Type: "bigint(20) NOT NULL"},
+			{Name: "ra", Type: "double NOT NULL"},
+			{Name: "decl", Type: "double NOT NULL"},
+		},
+	}
+	filter := schema.Table{
+		Table:  "Filter",
+		Schema: []schema.Column{{Name: "filterId", Type: "tinyint(4) NOT NULL"}},
+	}
+	schemas = map[string]*schema.Table{"Object": &object, "Filter": &filter}
+	cfg.Delimiter = '\t'
+	assert.Equal(t, 2, checkTables(inputDir, dataFiles(tables), schemas, perTable(fieldCountChecker), cfg), "Each row of Filter.csv has an extra field")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "Filter", "Filter.csv"), []byte("0\n1\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "Object", "DIR1", "chunk_1.txt"), []byte("1\t10.0\n"), 0644))
+	assert.Equal(t, 1, checkTables(inputDir, dataFiles(tables), schemas, perTable(fieldCountChecker), cfg), "Chunk row has a missing field")
+}
+
+// TestValueChecker check values are validated against column types
+func TestValueChecker(t *testing.T) {
+	testDir := testDataDir()
+	tables := walkDirs(testDir, Config{})
+	schemas, err := loadSchemas(tables, testDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, checkTables(testDir, dataFiles(tables), schemas, perTable(valueChecker), Config{Workers: 2}))
+
+	filter := schemas["Filter"]
+	checkRow := valueChecker(filter)
+	column, msg := checkRow(splitFields([]byte("1\tg\t1.2\t0.5"), '\t'))
+	assert.Equal(t, "", msg)
+	assert.Equal(t, "", column)
+	column, msg = checkRow(splitFields([]byte("1\t\\N\t1.2\t0.5"), '\t'))
+	assert.Equal(t, "filterName", column)
+	assert.Equal(t, "NULL value in NOT NULL column", msg)
+	column, msg = checkRow(splitFields([]byte("1000\tg\t1.2\t0.5"), '\t'))
+	assert.Equal(t, "filterId", column)
+	assert.NotEqual(t, "", msg)
+
+	res := checkFile(filepath.Join(testDir, "Filter", "Filter.tsv"), "Filter/Filter.tsv", '\t', checkRow, 2)
+	assert.NoError(t, res.err)
+	assert.Equal(t, 2, res.rows, "Only sampled rows should be checked")
+}
@@ -0,0 +1,249 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Compute and verify checksum manifests of chunk contribution files
+
+package metadata
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// Supported checksum algorithms, and the extension of their manifest file
+var checksumAlgorithms = map[string]struct {
+	ext     string
+	newHash func() hash.Hash
+}{
+	"sha256": {".sha256", sha256.New},
+	"xxhash": {".xxh64", func() hash.Hash { return xxhash.New() }},
+}
+
+type checksum struct {
+	rpath string
+	sum   string
+	err   error
+}
+
+// newHash returns a hash function for a checksum algorithm name
+func newHash(algorithm string) (func() hash.Hash, error) {
+	alg, ok := checksumAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+	return alg.newHash, nil
+}
+
+// manifestPath returns the path of the manifest written alongside the metadata file
+func manifestPath(outFile string, algorithm string) string {
+	return filepath.Join(filepath.Dir(outFile), "manifest"+checksumAlgorithms[algorithm].ext)
+}
+
+// manifestAlgorithm returns the checksum algorithm matching a manifest file extension
+func manifestAlgorithm(manifestFile string) (string, error) {
+	for name, alg := range checksumAlgorithms {
+		if filepath.Ext(manifestFile) == alg.ext {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unable to guess checksum algorithm for manifest %q", manifestFile)
+}
+
+// hashFile returns the hexadecimal checksum of a file
+func hashFile(filename string, newHash func() hash.Hash) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := newHash()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// computeChecksums hashes files located in inputDir using a pool of workers,
+// results are returned in the same order as files
+func computeChecksums(inputDir string, files []string, algorithm string, nbWorkers int) ([]checksum, error) {
+	newHash, err := newHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if isArchive(inputDir) {
+		return nil, fmt.Errorf("checksums are not supported for archive %q, use extraction first", inputDir)
+	}
+
+	results := make([]checksum, len(files))
+	parallel(len(files), nbWorkers, func(i int) {
+		sum, err := hashFile(filepath.Join(inputDir, files[i]), newHash)
+		results[i] = checksum{rpath: files[i], sum: sum, err: err}
+	})
+	return results, nil
+}
+
+// writeManifest writes the checksums of files, using the format of sha256sum
+func writeManifest(inputDir string, files []string, manifestFile string, cfg Config) error {
+	checksums, err := computeChecksums(inputDir, files, cfg.Checksum, workers(cfg))
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(manifestFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, c := range checksums {
+		if c.err != nil {
+			return c.err
+		}
+		_, err = fmt.Fprintf(w, "%s  %s\n", c.sum, filepath.ToSlash(c.rpath))
+		if err != nil {
+			return err
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// readManifest returns the checksums listed in a manifest file
+func readManifest(manifestFile string) ([]checksum, error) {
+	f, err := os.Open(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var checksums []checksum
+	sc := bufio.NewScanner(f)
+	lineNum := 0
+	for sc.Scan() {
+		lineNum++
+		line := sc.Text()
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		fields := strings.SplitN(line, "  ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("in manifest %q, line %d: invalid format", manifestFile, lineNum)
+		}
+		checksums = append(checksums, checksum{rpath: fields[1], sum: fields[0]})
+	}
+	return checksums, sc.Err()
+}
+
+// unlistedFiles returns data files located in inputDir which are not listed in checksums
+func unlistedFiles(inputDir string, checksums []checksum) ([]string, error) {
+	listed := make(map[string]bool, len(checksums))
+	for _, c := range checksums {
+		listed[c.rpath] = true
+	}
+	var unlisted []string
+	err := filepath.WalkDir(inputDir, func(path string, info fs.DirEntry, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		ftype, _, err := filetype(info.Name())
+		if err != nil || !isDataFile(ftype) {
+			return err
+		}
+		rpath, err := filepath.Rel(inputDir, path)
+		if err != nil {
+			return err
+		}
+		if !listed[filepath.ToSlash(rpath)] {
+			unlisted = append(unlisted, filepath.ToSlash(rpath))
+		}
+		return nil
+	})
+	return unlisted, err
+}
+
+// verify rechecks the data files of inputDir against a manifest,
+// and returns the number of detected errors
+func verify(inputDir string, manifestFile string, nbWorkers int) (int, error) {
+	algorithm, err := manifestAlgorithm(manifestFile)
+	if err != nil {
+		return 0, err
+	}
+	expected, err := readManifest(manifestFile)
+	if err != nil {
+		return 0, err
+	}
+	files := make([]string, len(expected))
+	for i, c := range expected {
+		files[i] = c.rpath
+	}
+	actual, err := computeChecksums(inputDir, files, algorithm, nbWorkers)
+	if err != nil {
+		return 0, err
+	}
+
+	errCount := 0
+	for i, c := range actual {
+		if c.err != nil {
+			log.Error().Str("File", c.rpath).AnErr("Error", c.err).Msg("Unable to compute checksum")
+			errCount++
+		} else if c.sum != expected[i].sum {
+			log.Error().Str("File", c.rpath).Str("Expected", expected[i].sum).Str("Actual", c.sum).Msg("Checksum mismatch")
+			errCount++
+		}
+	}
+	unlisted, err := unlistedFiles(inputDir, expected)
+	if err != nil {
+		return errCount, err
+	}
+	for _, rpath := range unlisted {
+		log.Error().Str("File", rpath).Msg("Data file not listed in manifest")
+		errCount++
+	}
+	return errCount, nil
+}
+
+// Verify rechecks the data files of inputDir against a checksum manifest
+func Verify(inputDir string, manifestFile string, cfg Config) {
+
+	log.Info().Str("Path", inputDir).Str("Manifest", manifestFile).Msg("Verify data files")
+	errCount, err := verify(inputDir, manifestFile, workers(cfg))
+	if err != nil {
+		log.Fatal().AnErr("Verify", err).Msg("Error while verifying data files")
+	}
+	if errCount != 0 {
+		log.Fatal().Int("Errors", errCount).Msg("Error: data files differ from manifest")
+	}
+	log.Info().Msg("All data files match manifest")
+}
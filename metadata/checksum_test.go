@@ -0,0 +1,72 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// addTestFiles writes files, indexed by their path relative to inputDir, and adds them to tables if not nil
+func addTestFiles(t *testing.T, inputDir string, tables TableMap, files map[string]string) {
+	for rpath, content := range files {
+		path := filepath.Join(inputDir, rpath)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		if tables != nil {
+			assert.NoError(t, addDataFile(tables, path, rpath))
+		}
+	}
+}
+
+// writeTestTree creates a small data tree and returns its tables
+func writeTestTree(t *testing.T, inputDir string) TableMap {
+	tables := make(TableMap)
+	addTestFiles(t, inputDir, tables, map[string]string{
+		"Object/DIR1/chunk_1.txt":         "1\t10.0\t-5.0\n",
+		"Object/DIR1/chunk_1_overlap.txt": "2\t10.1\t-5.0\n",
+		"Filter/Filter.csv":               "0,u\n1,g\n",
+	})
+	return tables
+}
+
+// TestDataFiles check metadata.dataFiles() lists all data files of a table map
+func TestDataFiles(t *testing.T) {
+	tables := writeTestTree(t, t.TempDir())
+	expected := []dataFile{
+		{table: "Filter", key: "Filter/", rpath: "Filter/Filter.csv", ftype: Csv, chunkId: -1},
+		{table: "Object", key: "Object/DIR1/", rpath: "Object/DIR1/chunk_1.txt", ftype: Chunk, chunkId: 1},
+		{table: "Object", key: "Object/DIR1/", rpath: "Object/DIR1/chunk_1_overlap.txt", ftype: Overlap, chunkId: 1},
+	}
+	assert.Equal(t, expected, dataFiles(tables))
+}
+
+func rpaths(files []dataFile) []string {
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.rpath)
+	}
+	return paths
+}
+
+// TestVerify check metadata.verify() detects modified and unlisted files
+func TestVerify(t *testing.T) {
+	for _, algorithm := range []string{"sha256", "xxhash"} {
+		inputDir := t.TempDir()
+		tables := writeTestTree(t, inputDir)
+		manifestFile := manifestPath(filepath.Join(t.TempDir(), "metadata.json"), algorithm)
+		cfg := Config{Checksum: algorithm, Workers: 2}
+		assert.NoError(t, writeManifest(inputDir, rpaths(dataFiles(tables)), manifestFile, cfg))
+
+		errCount, err := verify(inputDir, manifestFile, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, errCount, "Unmodified tree should match manifest")
+
+		assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "Filter", "Filter.csv"), []byte("0,z\n"), 0644))
+		assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "Object", "DIR1", "chunk_2.txt"), []byte("3\n"), 0644))
+		errCount, err = verify(inputDir, manifestFile, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, errCount, "Modified and unlisted files should be reported")
+	}
+}
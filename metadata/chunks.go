@@ -0,0 +1,151 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Check that rows of chunk files are located inside their chunk, or inside its overlap
+
+package metadata
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/fjammes/qserv-tools/v2/database"
+	"github.com/fjammes/qserv-tools/v2/partition"
+	"github.com/fjammes/qserv-tools/v2/schema"
+	"github.com/rs/zerolog/log"
+)
+
+// Tolerance, in degrees, of position checks, for rounding errors at chunk boundaries
+const positionTolerance = 1e-9
+
+// dataColumnIndex returns the index of a column in the rows of contribution files, or -1
+func dataColumnIndex(t *schema.Table, name string) int {
+	for i, c := range dataColumns(t) {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// chunkFiles returns chunk and overlap files of the partitioned tables which have position columns
+func chunkFiles(tables TableMap, schemas map[string]*schema.Table) []dataFile {
+	var files []dataFile
+	for _, file := range dataFiles(tables) {
+		if file.ftype != Chunk && file.ftype != Overlap {
+			continue
+		}
+		t := schemas[file.table]
+		if t.LatitudeKey == "" || t.LongitudeKey == "" {
+			log.Debug().Str("Table", file.table).Str("File", file.rpath).Msg("Skip file, table has no position columns")
+			continue
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// chunkChecker checks that rows of chunk files are inside their chunk, and overlap rows inside its overlap
+func chunkChecker(c *partition.Chunker) checkerFactory {
+	return func(t *schema.Table, file dataFile) rowChecker {
+		lonIdx := dataColumnIndex(t, t.LongitudeKey)
+		latIdx := dataColumnIndex(t, t.LatitudeKey)
+		var box partition.Box
+		var boxErr error
+		if file.ftype == Overlap {
+			box, boxErr = c.OverlapBox(file.chunkId)
+		} else {
+			box, boxErr = c.ChunkBox(file.chunkId)
+		}
+		return func(fields [][]byte) (string, string) {
+			if boxErr != nil {
+				return "", boxErr.Error()
+			}
+			if lonIdx < 0 || latIdx < 0 {
+				return "", fmt.Sprintf("position columns %q and %q not found in schema", t.LongitudeKey, t.LatitudeKey)
+			}
+			if lonIdx >= len(fields) || latIdx >= len(fields) {
+				return "", fmt.Sprintf("found %d fields, position columns are missing", len(fields))
+			}
+			lon, err := strconv.ParseFloat(string(fields[lonIdx]), 64)
+			if err != nil {
+				return t.LongitudeKey, fmt.Sprintf("invalid longitude %q", fields[lonIdx])
+			}
+			lat, err := strconv.ParseFloat(string(fields[latIdx]), 64)
+			if err != nil {
+				return t.LatitudeKey, fmt.Sprintf("invalid latitude %q", fields[latIdx])
+			}
+			if box.Contains(lon, lat, positionTolerance) {
+				return "", ""
+			}
+			if file.ftype == Overlap {
+				return "", fmt.Sprintf("position (%v, %v) is outside the overlap of chunk %d", lon, lat, file.chunkId)
+			}
+			chunkId, _ := c.Locate(lon, lat)
+			return "", fmt.Sprintf("position (%v, %v) belongs to chunk %d", lon, lat, chunkId)
+		}
+	}
+}
+
+// loadChunker returns the chunker of the partitioning parameters of a database JSON file
+func loadChunker(dbFile string) (*partition.Chunker, error) {
+	db, err := database.Load(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	chunker, err := partition.NewChunker(db.Overlap, db.NumStripes, db.NumSubStripes)
+	if err != nil {
+		return nil, fmt.Errorf("in file %q: %v", dbFile, err)
+	}
+	return chunker, nil
+}
+
+// CheckChunks checks that the position of each row of the chunk and overlap files matches its chunk
+func CheckChunks(inputDir string, cfg Config) {
+
+	if isArchive(inputDir) {
+		log.Fatal().Str("Path", inputDir).Msg("Error: archives are not supported, use extraction first")
+	}
+	schemaDir := cfg.SchemaDir
+	if schemaDir == "" {
+		schemaDir = inputDir
+	}
+	dbFile := filepath.Join(schemaDir, cfg.DbJsonFile)
+	log.Info().Str("Path", inputDir).Str("Schemas", schemaDir).Str("Database", dbFile).Msg("Check chunk files")
+
+	chunker, err := loadChunker(dbFile)
+	if err != nil {
+		log.Fatal().AnErr("Partitioning", err).Msg("Error while loading partitioning parameters")
+	}
+
+	tables := scan(inputDir, cfg)
+	schemas, err := loadSchemas(tables, schemaDir)
+	if err != nil {
+		log.Fatal().AnErr("Schema", err).Msg("Error while loading table schemas")
+	}
+	errCount := checkTables(inputDir, chunkFiles(tables, schemas), schemas, chunkChecker(chunker), cfg)
+	if errCount != 0 {
+		log.Fatal().Int("Errors", errCount).Msg("Error: rows located outside their chunk")
+	}
+	log.Info().Msg("All chunk file rows are located inside their chunk")
+}
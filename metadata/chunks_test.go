@@ -0,0 +1,53 @@
+package metadata
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/fjammes/qserv-tools/v2/partition"
+	"github.com/fjammes/qserv-tools/v2/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestChunkChecker check rows of itest/case01 chunk files are inside their chunk,
+// and rows located in another chunk are reported
+func TestChunkChecker(t *testing.T) {
+	chunker, err := partition.NewChunker(0.01667, 85, 12)
+	assert.NoError(t, err)
+
+	testDir := testDataDir()
+	cfg := Config{Workers: 2}
+	tables := walkDirs(testDir, Config{})
+	schemas, err := loadSchemas(tables, testDir)
+	assert.NoError(t, err)
+	files := chunkFiles(tables, schemas)
+	assert.NotEmpty(t, files)
+	assert.Equal(t, 0, checkTables(testDir, files, schemas, chunkChecker(chunker), cfg))
+
+	inputDir := t.TempDir()
+	tables = writeTestTree(t, inputDir)
+	object := schema.Table{
+		Table:        "Object",
+		LatitudeKey:  "decl",
+		LongitudeKey: "ra",
+		Schema: []schema.Column{
+			{Name: "objectId", Type: "bigint(20) NOT NULL"},
+			{Name: "ra", Type: "double NOT NULL"},
+			{Name: "decl", Type: "double NOT NULL"},
+		},
+	}
+	filter := schema.Table{Table: "Filter"}
+	schemas = map[string]*schema.Table{"Object": &object, "Filter": &filter}
+	cfg.Delimiter = '\t'
+	files = chunkFiles(tables, schemas)
+	assert.Equal(t, []string{"Object/DIR1/chunk_1.txt", "Object/DIR1/chunk_1_overlap.txt"}, rpaths(files))
+	assert.Equal(t, 2, checkTables(inputDir, files, schemas, chunkChecker(chunker), cfg), "Stripe 0 contains a single chunk")
+
+	checkRow := chunkChecker(chunker)(&object, dataFile{table: "Object", ftype: Chunk, chunkId: 6630})
+	_, msg := checkRow(splitFields([]byte("1\t10.0\t-5.0"), '\t'))
+	chunkId, _ := chunker.Locate(10.0, -5.0)
+	assert.Contains(t, msg, "belongs to chunk")
+	assert.Contains(t, msg, fmt.Sprint(chunkId))
+	column, msg := checkRow(splitFields([]byte("1\tx\t-5.0"), '\t'))
+	assert.Equal(t, "ra", column, msg)
+}
@@ -0,0 +1,168 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Compare chunk sets of director and child tables in a generated metadata.json file
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fjammes/qserv-tools/v2/schema"
+	"github.com/rs/zerolog/log"
+)
+
+// coverage lists the chunks of a child table which differ from the ones of its director table
+type coverage struct {
+	Table    string `json:"table"`
+	Director string `json:"director_table"`
+	// Chunks of the child table which are absent from the director table
+	MissingInDirector []int `json:"missing_in_director"`
+	// Chunks of the director table which are absent from the child table
+	MissingInChild []int `json:"missing_in_child"`
+}
+
+// loadMetadata reads a metadata.json file
+func loadMetadata(filename string) (*metadata, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var m metadata
+	err = json.Unmarshal(content, &m)
+	if err != nil {
+		return nil, fmt.Errorf("in file %q: %v", filename, err)
+	}
+	return &m, nil
+}
+
+// tableChunks returns the set of chunk ids of all data directories of a table
+func tableChunks(t table) map[int]bool {
+	chunks := make(map[int]bool)
+	for _, d := range t.Data {
+		for _, c := range d.Chunks {
+			chunks[c] = true
+		}
+	}
+	return chunks
+}
+
+// difference returns the sorted elements of a which are absent from b
+func difference(a map[int]bool, b map[int]bool) []int {
+	diff := []int{}
+	for c := range a {
+		if !b[c] {
+			diff = append(diff, c)
+		}
+	}
+	sort.Ints(diff)
+	return diff
+}
+
+// schemaTableName returns the table name of a schema file name, like "Object.json"
+func schemaTableName(schemaFile string) string {
+	return strings.TrimSuffix(filepath.Base(schemaFile), ".json")
+}
+
+// chunkCoverage compares the chunks of each child table with those of its director, tables being sorted by name
+func chunkCoverage(m *metadata, schemas map[string]*schema.Table) []coverage {
+	chunks := make(map[string]map[int]bool)
+	for _, t := range m.Tables {
+		chunks[schemaTableName(t.Schema)] = tableChunks(t)
+	}
+	var report []coverage
+	for name, childChunks := range chunks {
+		t := schemas[name]
+		if t == nil || !isChild(t) {
+			continue
+		}
+		directorChunks := chunks[t.DirectorTable]
+		report = append(report, coverage{
+			Table:             name,
+			Director:          t.DirectorTable,
+			MissingInDirector: difference(childChunks, directorChunks),
+			MissingInChild:    difference(directorChunks, childChunks),
+		})
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Table < report[j].Table
+	})
+	return report
+}
+
+// loadMetadataSchemas reads the schema JSON files of the tables of a metadata.json file from schemaDir
+func loadMetadataSchemas(m *metadata, schemaDir string) (map[string]*schema.Table, error) {
+	schemas := make(map[string]*schema.Table)
+	for _, t := range m.Tables {
+		s, err := schema.Load(filepath.Join(schemaDir, t.Schema))
+		if err != nil {
+			return nil, fmt.Errorf("unable to load schema for table %q: %v", schemaTableName(t.Schema), err)
+		}
+		schemas[schemaTableName(t.Schema)] = s
+	}
+	return schemas, nil
+}
+
+// Coverage reports the chunks which differ between each child table and its director, in outFile if not empty
+func Coverage(metadataFile string, outFile string, cfg Config) {
+
+	schemaDir := cfg.SchemaDir
+	if schemaDir == "" {
+		schemaDir = filepath.Dir(metadataFile)
+	}
+	log.Info().Str("Path", metadataFile).Str("Schemas", schemaDir).Msg("Compare chunks of director and child tables")
+
+	m, err := loadMetadata(metadataFile)
+	if err != nil {
+		log.Fatal().AnErr("Metadata", err).Msg("Error while loading metadata file")
+	}
+	schemas, err := loadMetadataSchemas(m, schemaDir)
+	if err != nil {
+		log.Fatal().AnErr("Schema", err).Msg("Error while loading table schemas")
+	}
+
+	report := chunkCoverage(m, schemas)
+	for _, c := range report {
+		if len(c.MissingInDirector) != 0 {
+			log.Warn().Str("Table", c.Table).Str("Director", c.Director).Ints("Chunks", c.MissingInDirector).Msg("Chunks missing in director table")
+		}
+		if len(c.MissingInChild) != 0 {
+			log.Warn().Str("Table", c.Table).Str("Director", c.Director).Ints("Chunks", c.MissingInChild).Msg("Director chunks missing in child table")
+		}
+		log.Info().Str("Table", c.Table).Str("Director", c.Director).Int("MissingInDirector", len(c.MissingInDirector)).Int("MissingInChild", len(c.MissingInChild)).Msg("Chunk coverage compared")
+	}
+
+	if outFile != "" {
+		log.Info().Str("Path", outFile).Msg("Generate coverage report")
+		content, err := json.MarshalIndent(report, "", "  ")
+		check(err)
+		err = os.WriteFile(outFile, append(content, '\n'), 0644)
+		if err != nil {
+			log.Fatal().AnErr("Report", err).Msg("Error while writing coverage report")
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package metadata
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/fjammes/qserv-tools/v2/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestChunkCoverage check chunks of child tables are compared with chunks of their director table
+func TestChunkCoverage(t *testing.T) {
+	testDir := testDataDir()
+	m, err := loadMetadata(filepath.Join(testDir, "metadata.json"))
+	assert.NoError(t, err)
+	schemas, err := loadMetadataSchemas(m, testDir)
+	assert.NoError(t, err)
+	expected := []coverage{
+		{Table: "Source", Director: "Object", MissingInDirector: []int{}, MissingInChild: []int{}},
+	}
+	assert.Equal(t, expected, chunkCoverage(m, schemas))
+
+	m = &metadata{
+		Tables: []table{
+			{Schema: "Object.json", Data: []data{{Chunks: []int{1, 2}}, {Chunks: []int{3}}}},
+			{Schema: "Source.json", Data: []data{{Chunks: []int{2, 4}}}},
+			{Schema: "DiaSource.json", Data: []data{{Chunks: []int{5}}}},
+			{Schema: "Filter.json", Data: []data{{Files: []string{"Filter.csv"}}}},
+		},
+	}
+	schemas = map[string]*schema.Table{
+		"Object":    {Table: "Object", IsPartitioned: 1},
+		"Source":    {Table: "Source", IsPartitioned: 1, DirectorTable: "Object"},
+		"DiaSource": {Table: "DiaSource", IsPartitioned: 1, DirectorTable: "DiaObject"},
+		"Filter":    {Table: "Filter"},
+	}
+	expected = []coverage{
+		{Table: "DiaSource", Director: "DiaObject", MissingInDirector: []int{5}, MissingInChild: []int{}},
+		{Table: "Source", Director: "Object", MissingInDirector: []int{4}, MissingInChild: []int{1, 3}},
+	}
+	assert.Equal(t, expected, chunkCoverage(m, schemas))
+}
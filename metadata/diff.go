@@ -0,0 +1,276 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Compare two metadata.json files, by table and data entry
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Status of a table or a data entry in the second file of a comparison
+const (
+	statusAdded   = "added"
+	statusRemoved = "removed"
+	statusChanged = "changed"
+)
+
+// entryDiff is a data entry which differs between two metadata files
+type entryDiff struct {
+	Directory       string   `json:"directory"`
+	FilePrefix      string   `json:"file_prefix,omitempty"`
+	Status          string   `json:"status"`
+	AddedChunks     []int    `json:"added_chunks,omitempty"`
+	RemovedChunks   []int    `json:"removed_chunks,omitempty"`
+	AddedOverlaps   []int    `json:"added_overlaps,omitempty"`
+	RemovedOverlaps []int    `json:"removed_overlaps,omitempty"`
+	AddedFiles      []string `json:"added_files,omitempty"`
+	RemovedFiles    []string `json:"removed_files,omitempty"`
+}
+
+// tableDiff is a table which differs between two metadata files
+type tableDiff struct {
+	Schema         string      `json:"schema"`
+	Status         string      `json:"status"`
+	AddedIndexes   []string    `json:"added_indexes,omitempty"`
+	RemovedIndexes []string    `json:"removed_indexes,omitempty"`
+	Entries        []entryDiff `json:"entries,omitempty"`
+}
+
+// metadataDiff lists the differences between two metadata files
+type metadataDiff struct {
+	// Old and new database JSON files, if they differ
+	Database []string    `json:"database,omitempty"`
+	Tables   []tableDiff `json:"tables"`
+}
+
+func (d *metadataDiff) empty() bool {
+	return len(d.Database) == 0 && len(d.Tables) == 0
+}
+
+// setDiff returns the elements of b absent from a, and the elements of a absent from b, sorted
+func setDiff[T int | string](a []T, b []T) ([]T, []T) {
+	inA := make(map[T]bool, len(a))
+	for _, v := range a {
+		inA[v] = true
+	}
+	inB := make(map[T]bool, len(b))
+	var added []T
+	for _, v := range b {
+		inB[v] = true
+		if !inA[v] {
+			added = append(added, v)
+		}
+	}
+	var removed []T
+	for _, v := range a {
+		if !inB[v] {
+			removed = append(removed, v)
+		}
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i] < added[j] })
+	sort.Slice(removed, func(i, j int) bool { return removed[i] < removed[j] })
+	return added, removed
+}
+
+// compareEntries returns the difference between two data entries, ok being false if they are identical
+func compareEntries(a data, b data) (entryDiff, bool) {
+	d := entryDiff{Directory: b.Directory, FilePrefix: b.FilePrefix, Status: statusChanged}
+	d.AddedChunks, d.RemovedChunks = setDiff(a.Chunks, b.Chunks)
+	d.AddedOverlaps, d.RemovedOverlaps = setDiff(a.Overlaps, b.Overlaps)
+	d.AddedFiles, d.RemovedFiles = setDiff(a.Files, b.Files)
+	changed := len(d.AddedChunks)+len(d.RemovedChunks)+len(d.AddedOverlaps)+len(d.RemovedOverlaps)+
+		len(d.AddedFiles)+len(d.RemovedFiles) != 0
+	return d, changed
+}
+
+// entryPath identifies a data entry of a table
+func entryPath(d data) string {
+	return path.Join(d.Directory, d.FilePrefix)
+}
+
+// compareTables returns the difference between two tables, ok being false if they are identical
+func compareTables(a table, b table) (tableDiff, bool) {
+	d := tableDiff{Schema: b.Schema, Status: statusChanged}
+	d.AddedIndexes, d.RemovedIndexes = setDiff(a.Indexes, b.Indexes)
+	entries := make(map[string]data, len(a.Data))
+	for _, e := range a.Data {
+		entries[entryPath(e)] = e
+	}
+	seen := make(map[string]bool, len(b.Data))
+	for _, e := range b.Data {
+		p := entryPath(e)
+		seen[p] = true
+		old, ok := entries[p]
+		if !ok {
+			old = data{Directory: e.Directory, FilePrefix: e.FilePrefix}
+		}
+		ed, changed := compareEntries(old, e)
+		if !ok {
+			ed.Status = statusAdded
+		}
+		if changed || !ok {
+			d.Entries = append(d.Entries, ed)
+		}
+	}
+	for _, e := range a.Data {
+		if !seen[entryPath(e)] {
+			ed, _ := compareEntries(e, data{Directory: e.Directory, FilePrefix: e.FilePrefix})
+			ed.Status = statusRemoved
+			d.Entries = append(d.Entries, ed)
+		}
+	}
+	sort.Slice(d.Entries, func(i, j int) bool {
+		return path.Join(d.Entries[i].Directory, d.Entries[i].FilePrefix) < path.Join(d.Entries[j].Directory, d.Entries[j].FilePrefix)
+	})
+	return d, len(d.AddedIndexes)+len(d.RemovedIndexes)+len(d.Entries) != 0
+}
+
+// compareMetadata returns the differences between metadata a and b, tables being identified by their schema file
+func compareMetadata(a *metadata, b *metadata) *metadataDiff {
+	diff := &metadataDiff{Tables: []tableDiff{}}
+	if a.Database != b.Database {
+		diff.Database = []string{a.Database, b.Database}
+	}
+	tables := make(map[string]table, len(a.Tables))
+	for _, t := range a.Tables {
+		tables[t.Schema] = t
+	}
+	seen := make(map[string]bool, len(b.Tables))
+	for _, t := range b.Tables {
+		seen[t.Schema] = true
+		old, ok := tables[t.Schema]
+		if !ok {
+			old = table{Schema: t.Schema}
+		}
+		td, changed := compareTables(old, t)
+		if !ok {
+			td.Status = statusAdded
+		}
+		if changed || !ok {
+			diff.Tables = append(diff.Tables, td)
+		}
+	}
+	for _, t := range a.Tables {
+		if !seen[t.Schema] {
+			td, _ := compareTables(t, table{Schema: t.Schema})
+			td.Status = statusRemoved
+			diff.Tables = append(diff.Tables, td)
+		}
+	}
+	sort.Slice(diff.Tables, func(i, j int) bool { return diff.Tables[i].Schema < diff.Tables[j].Schema })
+	return diff
+}
+
+// loadCurrentMetadata reads a metadata file, converted to the current format version
+func loadCurrentMetadata(filename string) (*metadata, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	content, _, err = migrate(content, MetadataVersion)
+	if err != nil {
+		return nil, fmt.Errorf("in file %q: %v", filename, err)
+	}
+	var m metadata
+	if err := json.Unmarshal(content, &m); err != nil {
+		return nil, fmt.Errorf("in file %q: %v", filename, err)
+	}
+	return &m, nil
+}
+
+// formatIds returns ids as a comma separated list
+func formatIds[T int | string](ids []T) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = fmt.Sprint(id)
+	}
+	return strings.Join(s, ",")
+}
+
+// writeText writes the differences in a human readable format, one line per change
+func (d *metadataDiff) writeText(w io.Writer) {
+	if len(d.Database) != 0 {
+		fmt.Fprintf(w, "~ database %s -> %s\n", d.Database[0], d.Database[1])
+	}
+	signs := map[string]string{statusAdded: "+", statusRemoved: "-", statusChanged: "~"}
+	for _, t := range d.Tables {
+		fmt.Fprintf(w, "%s table %s\n", signs[t.Status], t.Schema)
+		if len(t.AddedIndexes) != 0 {
+			fmt.Fprintf(w, "    + indexes %s\n", formatIds(t.AddedIndexes))
+		}
+		if len(t.RemovedIndexes) != 0 {
+			fmt.Fprintf(w, "    - indexes %s\n", formatIds(t.RemovedIndexes))
+		}
+		for _, e := range t.Entries {
+			fmt.Fprintf(w, "  %s %s\n", signs[e.Status], path.Join(e.Directory, e.FilePrefix))
+			for _, c := range []struct {
+				sign string
+				name string
+				ids  string
+			}{
+				{"+", "chunks", formatIds(e.AddedChunks)},
+				{"-", "chunks", formatIds(e.RemovedChunks)},
+				{"+", "overlaps", formatIds(e.AddedOverlaps)},
+				{"-", "overlaps", formatIds(e.RemovedOverlaps)},
+				{"+", "files", formatIds(e.AddedFiles)},
+				{"-", "files", formatIds(e.RemovedFiles)},
+			} {
+				if c.ids != "" {
+					fmt.Fprintf(w, "    %s %s %s\n", c.sign, c.name, c.ids)
+				}
+			}
+		}
+	}
+}
+
+// Diff prints the differences between metadata files oldFile and newFile, in JSON if jsonOutput is set,
+// and returns true if they differ. Files are compared after conversion to the current format version
+func Diff(oldFile string, newFile string, jsonOutput bool) bool {
+	a, err := loadCurrentMetadata(oldFile)
+	if err != nil {
+		log.Fatal().AnErr("Metadata", err).Msg("Error while loading metadata file")
+	}
+	b, err := loadCurrentMetadata(newFile)
+	if err != nil {
+		log.Fatal().AnErr("Metadata", err).Msg("Error while loading metadata file")
+	}
+	diff := compareMetadata(a, b)
+	if jsonOutput {
+		content, err := json.MarshalIndent(diff, "", "  ")
+		check(err)
+		fmt.Println(string(content))
+	} else {
+		diff.writeText(os.Stdout)
+	}
+	log.Info().Str("Old", oldFile).Str("New", newFile).Int("Tables", len(diff.Tables)).Msg("Metadata files compared")
+	return !diff.empty()
+}
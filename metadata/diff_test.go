@@ -0,0 +1,79 @@
+package metadata
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareMetadata(t *testing.T) {
+	a := &metadata{
+		Database: "db.json",
+		Tables: []table{
+			{Schema: "Object.json", Data: []data{
+				{Directory: "Object/DIR1/", Chunks: []int{1, 2}, Overlaps: []int{1}},
+				{Directory: "Object/DIR2/", Chunks: []int{3}},
+			}},
+			{Schema: "Filter.json", Data: []data{{Directory: "Filter/", Files: []string{"Filter.csv"}}}},
+		},
+	}
+	assert.True(t, compareMetadata(a, a).empty())
+
+	b := &metadata{
+		Database: "db2.json",
+		Tables: []table{
+			{Schema: "Object.json", Indexes: []string{"idx_Object.json"}, Data: []data{
+				{Directory: "Object/DIR1/", Chunks: []int{4, 2}, Overlaps: []int{1}},
+				{Directory: "Object/DIR3/", Chunks: []int{5}},
+			}},
+			{Schema: "Source.json", Data: []data{{Directory: "Source/", Chunks: []int{1}}}},
+		},
+	}
+	diff := compareMetadata(a, b)
+	expected := &metadataDiff{
+		Database: []string{"db.json", "db2.json"},
+		Tables: []tableDiff{
+			{Schema: "Filter.json", Status: statusRemoved, Entries: []entryDiff{
+				{Directory: "Filter/", Status: statusRemoved, RemovedFiles: []string{"Filter.csv"}},
+			}},
+			{Schema: "Object.json", Status: statusChanged, AddedIndexes: []string{"idx_Object.json"}, Entries: []entryDiff{
+				{Directory: "Object/DIR1/", Status: statusChanged, AddedChunks: []int{4}, RemovedChunks: []int{1}},
+				{Directory: "Object/DIR2/", Status: statusRemoved, RemovedChunks: []int{3}},
+				{Directory: "Object/DIR3/", Status: statusAdded, AddedChunks: []int{5}},
+			}},
+			{Schema: "Source.json", Status: statusAdded, Entries: []entryDiff{
+				{Directory: "Source/", Status: statusAdded, AddedChunks: []int{1}},
+			}},
+		},
+	}
+	assert.Equal(t, expected, diff)
+
+	var out bytes.Buffer
+	diff.writeText(&out)
+	assert.Equal(t, `~ database db.json -> db2.json
+- table Filter.json
+  - Filter
+    - files Filter.csv
+~ table Object.json
+    + indexes idx_Object.json
+  ~ Object/DIR1
+    + chunks 4
+    - chunks 1
+  - Object/DIR2
+    - chunks 3
+  + Object/DIR3
+    + chunks 5
++ table Source.json
+  + Source
+    + chunks 1
+`, out.String())
+}
+
+// TestLoadCurrentMetadata check files of all versions are compared in the current format
+func TestLoadCurrentMetadata(t *testing.T) {
+	m, err := loadCurrentMetadata("../dbbench/metadata.json")
+	assert.NoError(t, err)
+	assert.Equal(t, MetadataVersion, m.Version)
+	assert.Nil(t, m.Tables[0].Indexes)
+}
@@ -0,0 +1,151 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Detect duplicate director keys across the chunk files of director tables
+
+package metadata
+
+import (
+	"sort"
+
+	"github.com/fjammes/qserv-tools/v2/schema"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+)
+
+// Maximum number of duplicate keys reported for each table
+const maxDuplicates = 100
+
+// duplicate is a key found in several rows
+type duplicate struct {
+	key    string
+	count  int
+	chunks []int
+}
+
+// findDuplicates returns the keys found more than once in shards, sorted by key
+func findDuplicates(shards *keyShards) ([]duplicate, error) {
+	var duplicates []duplicate
+	for i := 0; i < shards.size(); i++ {
+		counts := make(map[string]int)
+		err := shards.read(i, func(r keyRecord) {
+			counts[r.key]++
+		})
+		if err != nil {
+			return nil, err
+		}
+		chunks := make(map[string][]int)
+		err = shards.read(i, func(r keyRecord) {
+			if counts[r.key] > 1 {
+				chunks[r.key] = append(chunks[r.key], r.chunkId)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		for key, ids := range chunks {
+			sort.Ints(ids)
+			duplicates = append(duplicates, duplicate{key: key, count: len(ids), chunks: slices.Compact(ids)})
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].key < duplicates[j].key
+	})
+	return duplicates, nil
+}
+
+// tableChunkFiles returns the chunk files of a table, overlap files duplicating rows of other chunks
+func tableChunkFiles(tables TableMap, table string) []dataFile {
+	var files []dataFile
+	for _, file := range dataFiles(tables) {
+		if file.table == table && file.ftype == Chunk {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// tableDuplicates returns the duplicate director keys of a director table
+func tableDuplicates(inputDir string, tables TableMap, schemas map[string]*schema.Table, table string, cfg Config) ([]duplicate, error) {
+	shards, err := newKeyShards(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer shards.remove()
+
+	directorKey := func(t *schema.Table) string {
+		return t.DirectorKey
+	}
+	err = collectKeys(inputDir, tableChunkFiles(tables, table), schemas, directorKey, shards, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return findDuplicates(shards)
+}
+
+// CheckDuplicates checks that director keys are unique across all chunk files of each director table
+func CheckDuplicates(inputDir string, cfg Config) {
+
+	if isArchive(inputDir) {
+		log.Fatal().Str("Path", inputDir).Msg("Error: archives are not supported, use extraction first")
+	}
+	schemaDir := cfg.SchemaDir
+	if schemaDir == "" {
+		schemaDir = inputDir
+	}
+	log.Info().Str("Path", inputDir).Str("Schemas", schemaDir).Msg("Check duplicate director keys")
+
+	tables := scan(inputDir, cfg)
+	schemas, err := loadSchemas(tables, schemaDir)
+	if err != nil {
+		log.Fatal().AnErr("Schema", err).Msg("Error while loading table schemas")
+	}
+
+	tableNames := make([]string, 0, len(tables))
+	for table := range tables {
+		tableNames = append(tableNames, table)
+	}
+	sort.Strings(tableNames)
+	dupCount := 0
+	for _, table := range tableNames {
+		if !schemas[table].IsDirector() {
+			continue
+		}
+		duplicates, err := tableDuplicates(inputDir, tables, schemas, table, cfg)
+		if err != nil {
+			log.Fatal().Str("Table", table).AnErr("Error", err).Msg("Error while reading director keys")
+		}
+		for i, d := range duplicates {
+			if i == maxDuplicates {
+				log.Error().Str("Table", table).Int("Duplicates", len(duplicates)).Msg("Too many duplicate keys, only first ones are reported")
+				break
+			}
+			log.Error().Str("Table", table).Str("Key", d.key).Int("Rows", d.count).Ints("Chunks", d.chunks).Msg("Duplicate director key")
+		}
+		log.Info().Str("Table", table).Str("Column", schemas[table].DirectorKey).Int("Duplicates", len(duplicates)).Msg("Director keys checked")
+		dupCount += len(duplicates)
+	}
+	if dupCount != 0 {
+		log.Fatal().Int("Duplicates", dupCount).Msg("Error: duplicate director keys")
+	}
+	log.Info().Msg("All director keys are unique")
+}
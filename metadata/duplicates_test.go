@@ -0,0 +1,46 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/fjammes/qserv-tools/v2/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTableDuplicates check duplicate director keys are detected across chunks
+func TestTableDuplicates(t *testing.T) {
+	testDir := testDataDir()
+	cfg := Config{Workers: 2, Shards: 4, TmpDir: t.TempDir()}
+	tables := walkDirs(testDir, Config{})
+	schemas, err := loadSchemas(tables, testDir)
+	assert.NoError(t, err)
+	duplicates, err := tableDuplicates(testDir, tables, schemas, "Object", cfg)
+	assert.NoError(t, err)
+	assert.Empty(t, duplicates)
+
+	inputDir := t.TempDir()
+	tables = writeTestTree(t, inputDir)
+	addTestFiles(t, inputDir, tables, map[string]string{
+		"Object/DIR1/chunk_2.txt": "1\t11.0\t-5.0\n3\t11.0\t-5.0\n\\N\t11.0\t-5.0\n\\N\t11.0\t-5.0\n",
+		"Object/DIR2/chunk_2.txt": "3\t11.0\t-5.0\n",
+	})
+	object := schema.Table{
+		Table:         "Object",
+		IsPartitioned: 1,
+		DirectorKey:   "objectId",
+		Schema: []schema.Column{
+			{Name: "objectId", Type: "bigint(20) NOT NULL"},
+			{Name: "ra", Type: "double NOT NULL"},
+			{Name: "decl", Type: "double NOT NULL"},
+		},
+	}
+	schemas = map[string]*schema.Table{"Object": &object}
+	cfg.Delimiter = '\t'
+	duplicates, err = tableDuplicates(inputDir, tables, schemas, "Object", cfg)
+	assert.NoError(t, err)
+	expected := []duplicate{
+		{key: "1", count: 2, chunks: []int{1, 2}},
+		{key: "3", count: 2, chunks: []int{2}},
+	}
+	assert.Equal(t, expected, duplicates, "Overlap rows and NULL keys should be ignored")
+}
@@ -0,0 +1,167 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Write metadata JSON files table by table and data entry by data entry, from the scanned tables which
+// remain in memory, without building a metadata document. Output is identical to encoding/json, indented or compact
+
+package metadata
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Indentation of metadata JSON files
+const jsonIndent = "  "
+
+// metadataEncoder writes a metadata JSON document to a buffered writer
+type metadataEncoder struct {
+	w       *bufio.Writer
+	compact bool
+	err     error
+}
+
+func newMetadataEncoder(w io.Writer, compact bool) *metadataEncoder {
+	return &metadataEncoder{w: bufio.NewWriter(w), compact: compact}
+}
+
+// write writes strings, the first error being kept
+func (e *metadataEncoder) write(strs ...string) {
+	for _, s := range strs {
+		if e.err != nil {
+			return
+		}
+		_, e.err = e.w.WriteString(s)
+	}
+}
+
+// newline returns the separator preceding a value at depth, empty in compact mode
+func (e *metadataEncoder) newline(depth int) string {
+	if e.compact {
+		return ""
+	}
+	return "\n" + strings.Repeat(jsonIndent, depth)
+}
+
+// key returns a JSON object key and its separator
+func (e *metadataEncoder) key(name string) string {
+	if e.compact {
+		return fmt.Sprintf("%q:", name)
+	}
+	return fmt.Sprintf("%q: ", name)
+}
+
+// value writes the JSON encoding of v, at depth
+func (e *metadataEncoder) value(v interface{}, depth int) {
+	if e.err != nil {
+		return
+	}
+	var b []byte
+	if e.compact {
+		b, e.err = json.Marshal(v)
+	} else {
+		b, e.err = json.MarshalIndent(v, strings.Repeat(jsonIndent, depth), jsonIndent)
+	}
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+// encode writes the metadata of tables, in the order of tableNames, and flushes the writer. Findings are added to rep
+func (e *metadataEncoder) encode(database string, tables TableMap, tableNames []string, rep *report) error {
+	e.write("{", e.newline(1), e.key("version"))
+	e.value(formatVersion(tables), 1)
+	e.write(",", e.newline(1), e.key("database"))
+	e.value(database, 1)
+	e.write(",", e.newline(1), e.key("tables"), "[")
+	for i, tableName := range tableNames {
+		dataSpec := tables[tableName]
+		dirs := finalizeTable(tableName, dataSpec, rep)
+		if i > 0 {
+			e.write(",")
+		}
+		e.write(e.newline(2), "{", e.newline(3), e.key("schema"))
+		e.value(fmt.Sprintf("%s.json", tableName), 3)
+		if len(dataSpec.Indexes) != 0 {
+			e.write(",", e.newline(3), e.key("indexes"))
+			e.value(dataSpec.Indexes, 3)
+		}
+		e.write(",", e.newline(3), e.key("data"), "[")
+		for j, dir := range dirs {
+			if j > 0 {
+				e.write(",")
+			}
+			e.write(e.newline(4))
+			e.value(dataSpec.DataMap[dir], 4)
+		}
+		if len(dirs) != 0 {
+			e.write(e.newline(3))
+		}
+		e.write("]", e.newline(2), "}")
+	}
+	if len(tableNames) != 0 {
+		e.write(e.newline(1))
+	}
+	e.write("]", e.newline(0), "}\n")
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// writeMetadata writes the metadata of tables to a temporary file, readable by all and renamed to outFile once complete
+// unless cfg.report has errors, without indentation if cfg.Compact is set
+func writeMetadata(tables TableMap, outFile string, cfg Config) error {
+	tableNames, err := orderTables(tables, cfg.OrderedTables)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(outFile), "."+filepath.Base(outFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	err = newMetadataEncoder(f, cfg.Compact).encode(cfg.DbJsonFile, tables, tableNames, cfg.report)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if cfg.report != nil && cfg.report.count(severityError) != 0 {
+		f.Close()
+		return fmt.Errorf("validation found %d errors, %q is not written", cfg.report.count(severityError), outFile)
+	}
+	err = f.Chmod(0644)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), outFile)
+}
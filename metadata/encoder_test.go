@@ -0,0 +1,63 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEncode check streamed metadata is identical to encoding/json output
+func TestEncode(t *testing.T) {
+	testDir := testDataDir()
+	for _, compact := range []bool{false, true} {
+		tables := walkDirs(testDir, Config{IdxDir: testDir + "/idx"})
+		expected := convert(tables, nil)
+		expected.Database = "database.json"
+		sortMetadata(&expected)
+
+		tableNames, err := orderTables(tables, nil)
+		assert.NoError(t, err)
+		var out bytes.Buffer
+		assert.NoError(t, newMetadataEncoder(&out, compact).encode("database.json", tables, tableNames, nil))
+		var m metadata
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &m))
+		sortMetadata(&m)
+		assert.Equal(t, expected, m)
+		if compact {
+			assert.Equal(t, 1, bytes.Count(out.Bytes(), []byte("\n")), "Compact output should be a single line")
+		} else {
+			assert.Contains(t, out.String(), "{\n  \"version\": 12,\n  \"database\": \"database.json\",\n")
+		}
+	}
+
+	for _, compact := range []bool{false, true} {
+		var expected, out bytes.Buffer
+		enc := json.NewEncoder(&expected)
+		if !compact {
+			enc.SetIndent("", "  ")
+		}
+		assert.NoError(t, enc.Encode(metadata{Version: legacyVersion, Tables: []table{}}))
+		assert.NoError(t, newMetadataEncoder(&out, compact).encode("", TableMap{}, nil, nil))
+		assert.Equal(t, expected.String(), out.String(), "Empty metadata")
+	}
+}
+
+// TestWriteMetadata check metadata.json is not written if the ingest order is invalid
+func TestWriteMetadata(t *testing.T) {
+	tables := walkDirs(testDataDir(), Config{})
+	outFile := filepath.Join(t.TempDir(), "metadata.json")
+	assert.Error(t, writeMetadata(tables, outFile, Config{OrderedTables: []string{"Object"}}))
+	assert.NoFileExists(t, outFile)
+
+	assert.NoError(t, writeMetadata(tables, outFile, Config{}))
+	entries, err := os.ReadDir(filepath.Dir(outFile))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "Temporary file should be renamed")
+	info, err := os.Stat(outFile)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
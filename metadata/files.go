@@ -0,0 +1,95 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// List data files and process them in parallel
+
+package metadata
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// dataFile is a data file registered in a TableMap
+type dataFile struct {
+	table string
+	// key of its data entry in the table DataMap
+	key string
+	// path relative to the input directory
+	rpath   string
+	ftype   Filetype
+	chunkId int
+}
+
+// dataFiles returns all data files in tables, sorted by path
+func dataFiles(tables TableMap) []dataFile {
+	var files []dataFile
+	for tableName, dataSpec := range tables {
+		for dir, data := range dataSpec.DataMap {
+			for _, chunkId := range data.Chunks {
+				rpath := dir + fmt.Sprintf("chunk_%d.txt", chunkId)
+				files = append(files, dataFile{table: tableName, key: dir, rpath: rpath, ftype: Chunk, chunkId: chunkId})
+			}
+			for _, chunkId := range data.Overlaps {
+				rpath := dir + fmt.Sprintf("chunk_%d_overlap.txt", chunkId)
+				files = append(files, dataFile{table: tableName, key: dir, rpath: rpath, ftype: Overlap, chunkId: chunkId})
+			}
+			for _, file := range data.Files {
+				ftype, _, _ := filetype(file)
+				files = append(files, dataFile{table: tableName, key: dir, rpath: dir + file, ftype: ftype, chunkId: -1})
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].rpath < files[j].rpath
+	})
+	return files
+}
+
+func workers(cfg Config) int {
+	if cfg.Workers > 0 {
+		return cfg.Workers
+	}
+	return runtime.NumCPU()
+}
+
+// parallel calls fn(i) for i in [0, n) using a pool of nbWorkers goroutines
+func parallel(n int, nbWorkers int, fn func(i int)) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < nbWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,153 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Select the files of the input directory with include/exclude patterns, and handle unknown files
+
+package metadata
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// PolicyIgnore silently ignores unknown files, which are still listed in the scan summary
+const PolicyIgnore FilePolicy = "ignore"
+
+// ignoredFile is a file of the input directory which is not added to the metadata
+type ignoredFile struct {
+	rpath  string
+	reason string
+}
+
+// fileFilter selects the files added to the metadata, and records the ignored ones
+type fileFilter struct {
+	include []string
+	exclude []string
+	unknown FilePolicy
+	ignored []ignoredFile
+	report  *report
+}
+
+// ParseUnknownPolicy parses the policy for unknown files: ignore, warn or fail
+func ParseUnknownPolicy(s string) (FilePolicy, error) {
+	p := FilePolicy(s)
+	switch p {
+	case PolicyIgnore, PolicyWarn, PolicyFail:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown policy %q for unknown files, use ignore, warn or fail", s)
+}
+
+// ParsePatterns parses a comma separated list of glob patterns
+func ParsePatterns(s string) ([]string, error) {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+func newFileFilter(cfg Config) *fileFilter {
+	unknown := cfg.UnknownFiles
+	if unknown == "" {
+		unknown = PolicyFail
+	}
+	return &fileFilter{include: cfg.Include, exclude: cfg.Exclude, unknown: unknown, report: cfg.report}
+}
+
+// matchGlob returns true if pattern matches a file path or a parent directory, or its name if pattern has no slash
+func matchGlob(pattern string, rpath string) bool {
+	if !strings.Contains(pattern, "/") {
+		if ok, _ := path.Match(pattern, path.Base(rpath)); ok {
+			return true
+		}
+	}
+	for p := rpath; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, rpath string) (string, bool) {
+	for _, p := range patterns {
+		if matchGlob(p, rpath) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// accept returns true if a file of type ftype must be added to the metadata, or an error for unknown files with the fail policy and no report
+func (f *fileFilter) accept(rpath string, ftype Filetype) (bool, error) {
+	rpath = filepath.ToSlash(rpath)
+	if p, ok := matchAny(f.exclude, rpath); ok {
+		f.ignored = append(f.ignored, ignoredFile{rpath: rpath, reason: fmt.Sprintf("excluded by pattern %q", p)})
+		return false, nil
+	}
+	if len(f.include) != 0 {
+		if _, ok := matchAny(f.include, rpath); !ok {
+			f.ignored = append(f.ignored, ignoredFile{rpath: rpath, reason: "not matching include patterns"})
+			return false, nil
+		}
+	}
+	if ftype != Unknown {
+		return true, nil
+	}
+	if f.unknown == PolicyFail && f.report == nil {
+		return false, fmt.Errorf("Not recognized file %s", rpath)
+	}
+	f.ignored = append(f.ignored, ignoredFile{rpath: rpath, reason: "not recognized"})
+	return false, nil
+}
+
+// logSummary lists ignored files, unknown files being reported as warnings with the warn policy
+func (f *fileFilter) logSummary() {
+	if len(f.ignored) == 0 {
+		return
+	}
+	for _, file := range f.ignored {
+		ignored := finding{Code: codeFileIgnored, Severity: severityInfo, Path: file.rpath, Message: "Ignored file: " + file.reason}
+		if file.reason == "not recognized" {
+			switch f.unknown {
+			case PolicyWarn:
+				ignored.Code, ignored.Severity = codeFileUnknown, severityWarning
+			case PolicyFail:
+				ignored.Code, ignored.Severity = codeFileUnknown, severityError
+			}
+		}
+		f.report.add(ignored)
+	}
+	log.Info().Int("Ignored", len(f.ignored)).Msg("Some files were not added to the metadata")
+}
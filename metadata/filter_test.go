@@ -0,0 +1,48 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMatchGlob check patterns match file names, paths and parent directories
+func TestMatchGlob(t *testing.T) {
+	assert.True(t, matchGlob("*.md", "Object/README.md"))
+	assert.True(t, matchGlob(".DS_Store", "Object/DIR1/.DS_Store"))
+	assert.True(t, matchGlob("Object/DIR2", "Object/DIR2/chunk_1.txt"))
+	assert.True(t, matchGlob("Object/*/chunk_1.txt", "Object/DIR2/chunk_1.txt"))
+	assert.False(t, matchGlob("Object/*.txt", "Object/DIR2/chunk_1.txt"))
+	assert.False(t, matchGlob("Source", "Object/DIR2/chunk_1.txt"))
+}
+
+// TestWalkDirsFilter check unknown and excluded files are ignored according to configuration
+func TestWalkDirsFilter(t *testing.T) {
+	inputDir := t.TempDir()
+	writeTestTree(t, inputDir)
+	for _, rpath := range []string{"README", "Object/DIR1/.DS_Store"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(inputDir, rpath), []byte("x"), 0644))
+	}
+
+	filter := newFileFilter(Config{})
+	_, err := filter.accept("README", Unknown)
+	assert.Error(t, err, "Unknown files should fail by default")
+
+	tables := walkDirs(inputDir, Config{UnknownFiles: PolicyWarn, Exclude: []string{"Filter"}})
+	assert.Equal(t, []string{"Object/DIR1/chunk_1.txt", "Object/DIR1/chunk_1_overlap.txt"}, rpaths(dataFiles(tables)))
+
+	filter = newFileFilter(Config{UnknownFiles: PolicyIgnore, Include: []string{"Object/*"}})
+	for _, rpath := range []string{"Filter/Filter.csv", "Object/DIR1/.DS_Store", "Object/DIR1/chunk_1.txt"} {
+		loc, err := locate(rpath, nil)
+		assert.NoError(t, err)
+		_, err = filter.accept(rpath, loc.ftype)
+		assert.NoError(t, err)
+	}
+	expected := []ignoredFile{
+		{rpath: "Filter/Filter.csv", reason: "not matching include patterns"},
+		{rpath: "Object/DIR1/.DS_Store", reason: "not recognized"},
+	}
+	assert.Equal(t, expected, filter.ignored, "Ignored files should be listed")
+}
@@ -0,0 +1,249 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Detect empty, truncated and abnormally sized data files, which are usually left by interrupted copies
+
+package metadata
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// FilePolicy is the action applied to data files which fail integrity checks
+type FilePolicy string
+
+const (
+	// PolicyWarn logs a warning and keeps the file
+	PolicyWarn FilePolicy = "warn"
+	// PolicySkip logs a warning and removes the file from the metadata
+	PolicySkip FilePolicy = "skip"
+	// PolicyFail logs an error and stops the scan
+	PolicyFail FilePolicy = "fail"
+)
+
+// Ratio to the median size of the files of a table above which a file size is an outlier
+const outlierFactor = 10
+
+// Minimum number of files of a table required to detect size outliers
+const minOutlierFiles = 5
+
+// fileIssue describes a data file which fails an integrity check
+type fileIssue struct {
+	file    dataFile
+	size    int64
+	problem string
+}
+
+// parsePolicy checks a policy name
+func parsePolicy(s string) (FilePolicy, error) {
+	p := FilePolicy(s)
+	switch p {
+	case PolicyWarn, PolicySkip, PolicyFail:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown file policy %q, use warn, skip or fail", s)
+}
+
+// ParseFilePolicies parses table policies, like "Object=fail,Source=skip"
+func ParseFilePolicies(s string) (map[string]FilePolicy, error) {
+	policies := make(map[string]FilePolicy)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		table, name, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid table policy %q, expected <table>=<policy>", item)
+		}
+		p, err := parsePolicy(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		policies[strings.TrimSpace(table)] = p
+	}
+	return policies, nil
+}
+
+// ParseFilePolicy parses the default file policy, an empty string disabling integrity checks
+func ParseFilePolicy(s string) (FilePolicy, error) {
+	if s == "" {
+		return "", nil
+	}
+	return parsePolicy(s)
+}
+
+// endsWithNewline returns true if the last byte of a file is a newline
+func endsWithNewline(path string, size int64) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, size-1); err != nil && err != io.EOF {
+		return false, err
+	}
+	return last[0] == '\n', nil
+}
+
+// median returns the median of sizes
+func median(sizes []int64) int64 {
+	sorted := slices.Clone(sizes)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// inspectFiles returns empty, truncated and abnormally sized data files, sorted by path
+func inspectFiles(inputDir string, files []dataFile, cfg Config) ([]fileIssue, error) {
+	sizes := make([]int64, len(files))
+	problems := make([]string, len(files))
+	errs := make([]error, len(files))
+	parallel(len(files), workers(cfg), func(i int) {
+		path := filepath.Join(inputDir, files[i].rpath)
+		info, err := os.Stat(path)
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		sizes[i] = info.Size()
+		if sizes[i] == 0 {
+			problems[i] = "empty file"
+			return
+		}
+		ok, err := endsWithNewline(path, sizes[i])
+		if err != nil {
+			errs[i] = err
+		} else if !ok {
+			problems[i] = "file does not end with a newline, it may be truncated"
+		}
+	})
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("in file %q: %v", files[i].rpath, err)
+		}
+	}
+
+	// Group non-empty files by table and type to detect size outliers
+	groups := make(map[string][]int)
+	for i, file := range files {
+		if sizes[i] != 0 {
+			key := fmt.Sprintf("%s/%d", file.table, file.ftype)
+			groups[key] = append(groups[key], i)
+		}
+	}
+	for _, indexes := range groups {
+		if len(indexes) < minOutlierFiles {
+			continue
+		}
+		groupSizes := make([]int64, len(indexes))
+		for j, i := range indexes {
+			groupSizes[j] = sizes[i]
+		}
+		m := median(groupSizes)
+		for _, i := range indexes {
+			if problems[i] == "" && (sizes[i]*outlierFactor < m || sizes[i] > m*outlierFactor) {
+				problems[i] = fmt.Sprintf("file size is an outlier, median size of table files is %d bytes", m)
+			}
+		}
+	}
+
+	var issues []fileIssue
+	for i, problem := range problems {
+		if problem != "" {
+			issues = append(issues, fileIssue{file: files[i], size: sizes[i], problem: problem})
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		return issues[i].file.rpath < issues[j].file.rpath
+	})
+	return issues, nil
+}
+
+// removeDataFile removes a data file from its data entry in tables
+func removeDataFile(tables TableMap, file dataFile) {
+	d, ok := tables[file.table].DataMap[file.key]
+	if !ok {
+		return
+	}
+	switch file.ftype {
+	case Chunk:
+		if i := slices.Index(d.Chunks, file.chunkId); i != -1 {
+			d.Chunks = slices.Delete(d.Chunks, i, i+1)
+		}
+	case Overlap:
+		if i := slices.Index(d.Overlaps, file.chunkId); i != -1 {
+			d.Overlaps = slices.Delete(d.Overlaps, i, i+1)
+		}
+	default:
+		if i := slices.Index(d.Files, strings.TrimPrefix(file.rpath, file.key)); i != -1 {
+			d.Files = slices.Delete(d.Files, i, i+1)
+		}
+	}
+	tables[file.table].DataMap[file.key] = d
+}
+
+// checkIntegrity applies table file policies to failing data files, returning an error for the fail policy without report
+func checkIntegrity(inputDir string, tables TableMap, cfg Config) error {
+	issues, err := inspectFiles(inputDir, dataFiles(tables), cfg)
+	if err != nil {
+		return err
+	}
+	failCount := 0
+	for _, issue := range issues {
+		policy, ok := cfg.TablePolicies[issue.file.table]
+		if !ok {
+			policy = cfg.FilePolicy
+		}
+		if policy == "" {
+			policy = PolicyWarn
+		}
+		issueFinding := finding{
+			Code:     codeFileIntegrity,
+			Severity: severityWarning,
+			Table:    issue.file.table,
+			Path:     issue.file.rpath,
+			Message:  fmt.Sprintf("%s, size %d, policy %s", issue.problem, issue.size, policy),
+		}
+		if policy == PolicyFail {
+			issueFinding.Severity = severityError
+			failCount++
+		}
+		if policy == PolicySkip {
+			removeDataFile(tables, issue.file)
+			issueFinding.Message = "Skip file: " + issueFinding.Message
+		}
+		cfg.report.add(issueFinding)
+	}
+	// Failures are checked once the validation report is complete
+	if failCount != 0 && cfg.report == nil {
+		return fmt.Errorf("%d data files failed integrity checks", failCount)
+	}
+	return nil
+}
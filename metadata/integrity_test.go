@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeIntegrityTree creates chunk files of similar sizes, and an empty, a truncated and a huge one
+func writeIntegrityTree(t *testing.T, inputDir string) TableMap {
+	row := "1\t10.0\t-5.0\n"
+	files := map[string]string{
+		"Object/DIR1/chunk_5.txt": "",
+		"Object/DIR1/chunk_6.txt": strings.Repeat(row, 9) + "1\t10",
+		"Object/DIR1/chunk_7.txt": strings.Repeat(row, 200),
+		"Filter/Filter.csv":       "0,u\n1,g\n",
+	}
+	for i := 1; i <= 4; i++ {
+		files[fmt.Sprintf("Object/DIR1/chunk_%d.txt", i)] = strings.Repeat(row, 10+i)
+	}
+	tables := make(TableMap)
+	addTestFiles(t, inputDir, tables, files)
+	return tables
+}
+
+// TestInspectFiles check empty, truncated and outlier files are detected
+func TestInspectFiles(t *testing.T) {
+	inputDir := t.TempDir()
+	tables := writeIntegrityTree(t, inputDir)
+	issues, err := inspectFiles(inputDir, dataFiles(tables), Config{Workers: 2})
+	assert.NoError(t, err)
+	var paths []string
+	for _, issue := range issues {
+		paths = append(paths, issue.file.rpath)
+	}
+	assert.Equal(t, []string{"Object/DIR1/chunk_5.txt", "Object/DIR1/chunk_6.txt", "Object/DIR1/chunk_7.txt"}, paths)
+	assert.Equal(t, "empty file", issues[0].problem)
+	assert.Contains(t, issues[1].problem, "newline")
+	assert.Contains(t, issues[2].problem, "outlier")
+
+	issues, err = inspectFiles(testDataDir(), dataFiles(walkDirs(testDataDir(), Config{})), Config{Workers: 2})
+	assert.NoError(t, err)
+	assert.Len(t, issues, 4, "itest/case01 contains empty chunk files for chunks 16630 and 16631")
+	for _, issue := range issues {
+		assert.Equal(t, "empty file", issue.problem)
+	}
+}
+
+// TestCheckIntegrity check file policies are applied per table
+func TestCheckIntegrity(t *testing.T) {
+	inputDir := t.TempDir()
+	tables := writeIntegrityTree(t, inputDir)
+	cfg := Config{Workers: 2, FilePolicy: PolicyWarn, TablePolicies: map[string]FilePolicy{"Object": PolicySkip}}
+	assert.NoError(t, checkIntegrity(inputDir, tables, cfg))
+	assert.ElementsMatch(t, []int{1, 2, 3, 4}, tables["Object"].DataMap["Object/DIR1/"].Chunks, "Invalid files should be skipped")
+
+	tables = writeIntegrityTree(t, inputDir)
+	cfg.TablePolicies = map[string]FilePolicy{"Object": PolicyFail}
+	assert.Error(t, checkIntegrity(inputDir, tables, cfg))
+
+	policies, err := ParseFilePolicies("Object=fail, Source=skip")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]FilePolicy{"Object": PolicyFail, "Source": PolicySkip}, policies)
+	_, err = ParseFilePolicies("Object=ignore")
+	assert.Error(t, err)
+}
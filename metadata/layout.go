@@ -0,0 +1,153 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Derive table names and data entries from file paths, using the default <table>/<dir>/<file> layout
+// or a path template like "{release}/{table}/chunks/{run}/{file}"
+
+package metadata
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Placeholders of path templates which are not identifiers
+const (
+	tablePlaceholder = "table"
+	filePlaceholder  = "file"
+)
+
+// Regular expression of the data file names matched by the {file} placeholder
+const fileNameRe = `chunk_[0-9]+(?:_overlap)?\.txt|[^/]+\.(?:csv|tsv|json)`
+
+var placeholderRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// fileLocation is the table and data entry of a file, derived from its path
+type fileLocation struct {
+	table string
+	// Key of the data entry in DataSpec.DataMap, which is the path of the file without its name
+	key string
+	// Directory of the data entry
+	directory string
+	// Part of the file base name which precedes filename, for flat layouts like <table>_chunk_N.txt
+	prefix      string
+	filename    string
+	ftype       Filetype
+	chunkId     int
+	identifiers map[string]string
+}
+
+// pathTemplate extracts the table name and identifiers from file paths
+type pathTemplate struct {
+	template string
+	re       *regexp.Regexp
+}
+
+// parsePathTemplate compiles a path template containing {table} and ending with {file}, other placeholders being identifiers
+func parsePathTemplate(template string) (*pathTemplate, error) {
+	if !strings.HasSuffix(template, "{"+filePlaceholder+"}") {
+		return nil, fmt.Errorf("path template %q must end with {%s}", template, filePlaceholder)
+	}
+	if !strings.Contains(template, "{"+tablePlaceholder+"}") {
+		return nil, fmt.Errorf("path template %q must contain {%s}", template, tablePlaceholder)
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	names := make(map[string]bool)
+	last := 0
+	for _, m := range placeholderRe.FindAllStringSubmatchIndex(template, -1) {
+		expr.WriteString(regexp.QuoteMeta(template[last:m[0]]))
+		name := template[m[2]:m[3]]
+		if names[name] {
+			return nil, fmt.Errorf("path template %q contains {%s} twice", template, name)
+		}
+		names[name] = true
+		if name == filePlaceholder {
+			fmt.Fprintf(&expr, "(?P<%s>%s)", name, fileNameRe)
+		} else {
+			fmt.Fprintf(&expr, "(?P<%s>[^/]+?)", name)
+		}
+		last = m[1]
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid path template %q: %v", template, err)
+	}
+	return &pathTemplate{template: template, re: re}, nil
+}
+
+// newPathTemplate returns the path template of the configuration, or nil for the default layout
+func newPathTemplate(cfg Config) (*pathTemplate, error) {
+	if cfg.PathTemplate == "" {
+		return nil, nil
+	}
+	return parsePathTemplate(cfg.PathTemplate)
+}
+
+// locate returns the location of a file relative to the input directory, using tpl or the default layout if nil
+func locate(rpath string, tpl *pathTemplate) (fileLocation, error) {
+	dir, base := path.Split(rpath)
+	if tpl == nil {
+		ftype, chunkId, err := filetype(base)
+		loc := fileLocation{
+			table:     strings.SplitN(dir, "/", 2)[0],
+			key:       dir,
+			directory: dir,
+			filename:  base,
+			ftype:     ftype,
+			chunkId:   chunkId,
+		}
+		return loc, err
+	}
+
+	m := tpl.re.FindStringSubmatch(rpath)
+	if m == nil {
+		ftype, _, err := filetype(base)
+		if ftype != Json {
+			ftype = Unknown
+		}
+		return fileLocation{filename: base, ftype: ftype, chunkId: -1}, err
+	}
+	loc := fileLocation{directory: dir}
+	for i, name := range tpl.re.SubexpNames() {
+		switch name {
+		case "":
+		case tablePlaceholder:
+			loc.table = m[i]
+		case filePlaceholder:
+			loc.filename = m[i]
+		default:
+			if loc.identifiers == nil {
+				loc.identifiers = make(map[string]string)
+			}
+			loc.identifiers[name] = m[i]
+		}
+	}
+	loc.key = strings.TrimSuffix(rpath, loc.filename)
+	loc.prefix = strings.TrimPrefix(loc.key, dir)
+	var err error
+	loc.ftype, loc.chunkId, err = filetype(loc.filename)
+	return loc, err
+}
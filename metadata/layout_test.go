@@ -0,0 +1,70 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLocate check table names and identifiers are extracted with path templates
+func TestLocate(t *testing.T) {
+	_, err := parsePathTemplate("{table}/chunks")
+	assert.Error(t, err, "Template should end with {file}")
+	_, err = parsePathTemplate("{run}/{file}")
+	assert.Error(t, err, "Template should contain {table}")
+
+	tpl, err := parsePathTemplate("{release}/{table}/chunks/{run}/{file}")
+	assert.NoError(t, err)
+	loc, err := locate("dp02/Object/chunks/run_1/chunk_57_overlap.txt", tpl)
+	assert.NoError(t, err)
+	expected := fileLocation{
+		table:       "Object",
+		key:         "dp02/Object/chunks/run_1/",
+		directory:   "dp02/Object/chunks/run_1/",
+		filename:    "chunk_57_overlap.txt",
+		ftype:       Overlap,
+		chunkId:     57,
+		identifiers: map[string]string{"release": "dp02", "run": "run_1"},
+	}
+	assert.Equal(t, expected, loc)
+
+	loc, err = locate("dp02/Object/run_1/chunk_57.txt", tpl)
+	assert.NoError(t, err)
+	assert.Equal(t, Unknown, loc.ftype, "Files which do not match the template are unknown")
+
+	tpl, err = parsePathTemplate("{table}_{file}")
+	assert.NoError(t, err)
+	loc, err = locate("Dia_Object_chunk_3.txt", tpl)
+	assert.NoError(t, err)
+	assert.Equal(t, "Dia_Object", loc.table)
+	assert.Equal(t, "Dia_Object_", loc.prefix)
+	assert.Equal(t, Chunk, loc.ftype)
+}
+
+// TestWalkDirsTemplate check data entries of nested and flat layouts
+func TestWalkDirsTemplate(t *testing.T) {
+	inputDir := t.TempDir()
+	addTestFiles(t, inputDir, nil, map[string]string{
+		"Object_chunk_1.txt":         "1\n",
+		"Object_chunk_1_overlap.txt": "1\n",
+		"Filter_Filter.csv":          "1\n",
+		"Object.json":                "1\n",
+	})
+	tables := walkDirs(inputDir, Config{PathTemplate: "{table}_{file}"})
+	assert.Equal(t, []string{"Filter_Filter.csv", "Object_chunk_1.txt", "Object_chunk_1_overlap.txt"}, rpaths(dataFiles(tables)))
+	assert.Equal(t, data{FilePrefix: "Object_", Chunks: []int{1}, Overlaps: []int{1}}, tables["Object"].DataMap["Object_"])
+
+	inputDir = t.TempDir()
+	addTestFiles(t, inputDir, nil, map[string]string{
+		"Object/chunks/r1/chunk_1.txt": "1\n",
+		"Object/chunks/r2/chunk_2.txt": "1\n",
+	})
+	tables = walkDirs(inputDir, Config{PathTemplate: "{table}/chunks/{run}/{file}"})
+	m := convert(tables, nil)
+	sortMetadata(&m)
+	expected := []data{
+		{Directory: "Object/chunks/r1/", Identifiers: map[string]string{"run": "r1"}, Chunks: []int{1}},
+		{Directory: "Object/chunks/r2/", Identifiers: map[string]string{"run": "r2"}, Chunks: []int{2}},
+	}
+	assert.Equal(t, expected, m.Tables[0].Data, "Run identifiers should be kept in metadata")
+}
@@ -25,7 +25,6 @@
 package metadata
 
 import (
-	"encoding/json"
 	"fmt"
 	"io/fs"
 	"os"
@@ -35,6 +34,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"golang.org/x/exp/slices"
@@ -63,10 +63,65 @@ type Config struct {
 	DbJsonFile    string
 	OrderedTables []string
 	IdxDir        string
+	// Directory inside a tar archive which contains table directories
+	ArchiveRoot string
+	// Checksum algorithm used to write a manifest of data files, disabled if empty
+	Checksum string
+	// Number of files processed in parallel
+	Workers int
+	// Directory containing table schema JSON files, used to check data files
+	SchemaDir string
+	// Field delimiter of chunk files
+	Delimiter rune
+	// Check data values against column types
+	CheckValues bool
+	// Number of rows checked in each data file, 0 for all rows
+	SampleRows int
+	// Number of temporary shard files used to detect duplicate keys
+	Shards int
+	// Directory of temporary files, defaults to the system one
+	TmpDir string
+	// Policy applied to empty, truncated and abnormally sized data files, checks are disabled if empty
+	FilePolicy FilePolicy
+	// Policies overriding FilePolicy for some tables
+	TablePolicies map[string]FilePolicy
+	// Glob patterns of the files added to the metadata, all files if empty
+	Include []string
+	// Glob patterns of the files which are not added to the metadata
+	Exclude []string
+	// Policy for unrecognized files: ignore, warn or fail, defaults to fail
+	UnknownFiles FilePolicy
+	// Template deriving table names from file paths, like "{table}/chunks/{run}/{file}",
+	// the table name being the first path component if empty
+	PathTemplate string
+	// Regular expressions extracting provenance attributes, like tract, step and timestamp, from
+	// directory names with named groups, DefaultProvenancePatterns being used if empty
+	ProvenancePatterns []string
+	// Path of the provenance report of data entries, disabled if empty
+	ProvenanceFile string
+	// Tracts of the data entries added to the metadata, all tracts if empty
+	Tracts []string
+	// Glob patterns of the steps of the data entries added to the metadata, like "step5_*"
+	Steps []string
+	// Time window of the data entries added to the metadata, unbounded if zero
+	After  time.Time
+	Before time.Time
+	// Write metadata JSON files without indentation
+	Compact bool
+	// Path of the JSON validation report, disabled if empty
+	ReportFile string
+	// Promote warnings of the validation report to errors
+	Strict bool
+	// Validation report collecting findings, only logged if nil
+	report *report
 }
 
 type metadata struct {
+	// Version of the metadata format, see MetadataVersion
+	Version  int    `json:"version,omitempty"`
 	Database string `json:"database"`
+	// Dialect of the data files, by file extension
+	Formats map[string]format `json:"formats,omitempty"`
 	// map key is the schema file
 	Tables []table `json:"tables"`
 }
@@ -78,10 +133,14 @@ type table struct {
 }
 
 type data struct {
-	Directory string   `json:"directory,omitempty"`
-	Chunks    []int    `json:"chunks,omitempty"`
-	Overlaps  []int    `json:"overlaps,omitempty"`
-	Files     []string `json:"files,omitempty"`
+	Directory string `json:"directory,omitempty"`
+	// Prefix of the data file names of flat layouts, like "Object_" for Object_chunk_1.txt
+	FilePrefix string `json:"file_prefix,omitempty"`
+	// Identifiers extracted from the path template, like the run or the tract
+	Identifiers map[string]string `json:"identifiers,omitempty"`
+	Chunks      []int             `json:"chunks,omitempty"`
+	Overlaps    []int             `json:"overlaps,omitempty"`
+	Files       []string          `json:"files,omitempty"`
 }
 
 func check(e error) {
@@ -96,11 +155,17 @@ func logTable(tables map[string]table) {
 	}
 }
 
-func walkDirs(inputDir string, idxDir string) TableMap {
+// walkDirs returns the tables found in inputDir, files being located and selected according to cfg
+func walkDirs(inputDir string, cfg Config) TableMap {
 	// Ensure inputDir has no trailing slash
 	inputDir = filepath.Join(inputDir)
 
 	var tables TableMap = make(map[string]DataSpec)
+	filter := newFileFilter(cfg)
+	tpl, err := newPathTemplate(cfg)
+	if err != nil {
+		log.Fatal().AnErr("Template", err).Msg("Error in configuration")
+	}
 
 	// zerolog.SetGlobalLevel(zerolog.Disabled)
 	log.Info().Str("Path", inputDir).Msg("Add data files")
@@ -111,39 +176,66 @@ func walkDirs(inputDir string, idxDir string) TableMap {
 		if !info.IsDir() {
 			rpath := strings.TrimPrefix(path, inputDir)
 			rpath = strings.TrimPrefix(rpath, "/")
-			dir, filename := filepath.Split(rpath)
-
-			parts := strings.SplitN(dir, "/", 2)
-			tablename := parts[0]
-
-			log.Debug().Str("Directory", dir).Msg("")
-			log.Debug().Str("File", filename).Msg("")
-			log.Debug().Str("Table", tablename).Msg("")
-
-			ftype, chunkId, err := filetype(filename)
+			loc, err := locate(rpath, tpl)
 			if err != nil {
 				return err
 			}
-			if ftype == Unknown {
-				err = fmt.Errorf("Not recognized file %s", path)
+			ok, err := filter.accept(rpath, loc.ftype)
+			if !ok || err != nil {
 				return err
 			}
-			if isDataFile(ftype) {
-				err = appendMetadata(tables, tablename, dir, filename, ftype, chunkId)
-				if err != nil {
-					return err
-				}
-			}
-
+			return addLocatedFile(tables, path, loc)
 		}
 		return nil
 	}
-	err := filepath.WalkDir(inputDir, visitData)
+	err = filepath.WalkDir(inputDir, visitData)
 	if err != nil {
 		log.Fatal().AnErr("WalkDir", err).Msg("Error while scanning path")
 	}
 	// zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	filter.logSummary()
+
+	err = addIndexes(tables, cfg.IdxDir)
+	if err != nil {
+		log.Fatal().AnErr("WalkDir", err).Msg("Error while scanning path")
+	}
+	return tables
+}
+
+// addDataFile adds a data file with the default layout, rpath being its path relative to the input directory
+func addDataFile(tables TableMap, path string, rpath string) error {
+	loc, err := locate(rpath, nil)
+	if err != nil {
+		return err
+	}
+	return addLocatedFile(tables, path, loc)
+}
+
+// addLocatedFile registers a data file in tables, path being its full path
+func addLocatedFile(tables TableMap, path string, loc fileLocation) error {
+
+	log.Debug().Str("Directory", loc.directory).Msg("")
+	log.Debug().Str("File", loc.filename).Msg("")
+	log.Debug().Str("Table", loc.table).Msg("")
+
+	if loc.ftype == Unknown {
+		err := fmt.Errorf("Not recognized file %s", path)
+		return err
+	}
+	if isDataFile(loc.ftype) {
+		err := appendLocation(tables, loc)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// addIndexes attach index configuration files found in idxDir to their tables
+func addIndexes(tables TableMap, idxDir string) error {
+	if idxDir == "" {
+		return nil
+	}
 	log.Info().Str("Path", idxDir).Msg("Add index files")
 	visitIdx := func(path string, info fs.DirEntry, err error) error {
 
@@ -185,62 +277,78 @@ func walkDirs(inputDir string, idxDir string) TableMap {
 		return nil
 	}
 
-	err = filepath.WalkDir(idxDir, visitIdx)
-	if err != nil {
-		log.Fatal().AnErr("WalkDir", err).Msg("Error while scanning path")
-	}
-	return tables
+	return filepath.WalkDir(idxDir, visitIdx)
 }
 
-func convert(tables TableMap, orderedTables []string) metadata {
-	metadata := metadata{}
-	metadata.Tables = make([]table, 0, len(tables))
-
+// orderTables returns the names of tables in ingest order, if orderedTables is not empty
+func orderTables(tables TableMap, orderedTables []string) ([]string, error) {
 	dataTableNames := make([]string, 0, len(tables))
 	for k := range tables {
 		dataTableNames = append(dataTableNames, k)
 	}
 
 	if len(orderedTables) == 0 {
-		orderedTables = dataTableNames
-	} else {
-		sortedOrderedTables := make([]string, len(orderedTables))
-		sortedDataTableNames := make([]string, len(dataTableNames))
-		copy(sortedOrderedTables, orderedTables)
-		copy(sortedDataTableNames, dataTableNames)
-		sort.Strings(sortedOrderedTables)
-		sort.Strings(sortedDataTableNames)
-		if !reflect.DeepEqual(sortedOrderedTables, sortedDataTableNames) {
-			log.Fatal().Str("Ordered tables", fmt.Sprintf("%v", orderedTables)).Str("Data tables", fmt.Sprintf("%v", dataTableNames)).Msg("Error: tables provided by configuration differ from found tables")
-		}
+		return dataTableNames, nil
+	}
+	sortedOrderedTables := make([]string, len(orderedTables))
+	sortedDataTableNames := make([]string, len(dataTableNames))
+	copy(sortedOrderedTables, orderedTables)
+	copy(sortedDataTableNames, dataTableNames)
+	sort.Strings(sortedOrderedTables)
+	sort.Strings(sortedDataTableNames)
+	if !reflect.DeepEqual(sortedOrderedTables, sortedDataTableNames) {
+		return nil, fmt.Errorf("tables provided by configuration %v differ from found tables %v", orderedTables, dataTableNames)
 	}
+	return orderedTables, nil
+}
 
-	for _, tableName := range orderedTables {
-		dataSpec := tables[tableName]
-		var is_partitioned, is_regular bool
-		for dir, data := range dataSpec.DataMap {
-			// TODO Check a table does not have both chunk/overlap and files
-			if len(data.Chunks) != 0 || len(data.Overlaps) != 0 {
-				is_partitioned = true
-			}
-			if len(data.Files) != 0 {
-				is_regular = true
-			}
-			// Remove Overlap list if equals Chunk list
-			if len(data.Chunks) != 0 && slices.Equal(data.Chunks, data.Overlaps) {
-				log.Info().Str("Table", tableName).Str("Path", dir).Msg("Remove Overlaps")
-				data.Overlaps = []int(nil)
-			}
-			dataSpec.DataMap[dir] = data
+// finalizeTable removes redundant overlap lists of a table and returns its directories, a mixed table being fatal if rep is nil
+func finalizeTable(tableName string, dataSpec DataSpec, rep *report) []string {
+	var is_partitioned, is_regular bool
+	for dir, data := range dataSpec.DataMap {
+		// TODO Check a table does not have both chunk/overlap and files
+		if len(data.Chunks) != 0 || len(data.Overlaps) != 0 {
+			is_partitioned = true
+		}
+		if len(data.Files) != 0 {
+			is_regular = true
+		}
+		// Remove Overlap list if equals Chunk list
+		if len(data.Chunks) != 0 && slices.Equal(data.Chunks, data.Overlaps) {
+			rep.add(finding{Code: codeOverlapsRemoved, Severity: severityInfo, Table: tableName, Path: dir, Message: "Remove Overlaps"})
+			data.Overlaps = []int(nil)
 		}
-		if is_partitioned && is_regular {
+		dataSpec.DataMap[dir] = data
+	}
+	if is_partitioned && is_regular {
+		if rep == nil {
 			log.Fatal().Str("Partitioned", strconv.FormatBool(is_partitioned)).Str("Regular", strconv.FormatBool(is_regular)).Str("Table", tableName).Msg("Error while checking data consistency")
-		} else if !is_partitioned && !is_regular {
-			log.Warn().Str("Partitioned", strconv.FormatBool(is_partitioned)).Str("Regular", strconv.FormatBool(is_regular)).Str("Table", tableName).Msg("Table has no data")
 		}
+		rep.add(finding{Code: codeTableMixedData, Severity: severityError, Table: tableName, Message: "Table has both chunk files and regular files"})
+	} else if !is_partitioned && !is_regular {
+		rep.add(finding{Code: codeTableNoData, Severity: severityWarning, Table: tableName, Message: "Table has no data"})
+	}
+	dirs := make([]string, 0, len(dataSpec.DataMap))
+	for dir := range dataSpec.DataMap {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func convert(tables TableMap, orderedTables []string) metadata {
+	metadata := metadata{Version: formatVersion(tables)}
+	metadata.Tables = make([]table, 0, len(tables))
+
+	tableNames, err := orderTables(tables, orderedTables)
+	if err != nil {
+		log.Fatal().AnErr("Order", err).Msg("Error in configuration")
+	}
+	for _, tableName := range tableNames {
+		dataSpec := tables[tableName]
+		dirs := finalizeTable(tableName, dataSpec, nil)
 		dataList := make([]data, 0, len(dataSpec.DataMap))
-		for _, data := range dataSpec.DataMap {
-			dataList = append(dataList, data)
+		for _, dir := range dirs {
+			dataList = append(dataList, dataSpec.DataMap[dir])
 		}
 		table := table{
 			Schema:  fmt.Sprintf("%s.json", tableName),
@@ -259,11 +367,32 @@ func newDataSpec() *DataSpec {
 	return &dataspec
 }
 
-func newMetadata(inputDir string, cfg Config) *metadata {
-	tables := walkDirs(inputDir, cfg.IdxDir)
-	metadata := convert(tables, cfg.OrderedTables)
-	metadata.Database = cfg.DbJsonFile
-	return &metadata
+// requireInputDir exits if the path to input data is not set, as it has no default
+func requireInputDir(inputDir string) {
+	if inputDir == "" {
+		log.Fatal().Msg("Error in configuration: path to input data is required, see --path or the metadata path of the configuration file")
+	}
+}
+
+// scan returns the tables found in inputDir, which is a directory or a tar archive
+func scan(inputDir string, cfg Config) TableMap {
+	requireInputDir(inputDir)
+	checkFiles := cfg.FilePolicy != "" || len(cfg.TablePolicies) != 0
+	if isArchive(inputDir) {
+		if checkFiles {
+			log.Fatal().Str("Path", inputDir).Msg("Error in configuration: file checks require a data directory, extract the archive first")
+		}
+		return walkArchive(inputDir, cfg)
+	}
+	tables := walkDirs(inputDir, cfg)
+	if checkFiles {
+		log.Info().Str("Path", inputDir).Str("Policy", string(cfg.FilePolicy)).Msg("Check data files integrity")
+		err := checkIntegrity(inputDir, tables, cfg)
+		if err != nil {
+			log.Fatal().AnErr("Integrity", err).Msg("Error while checking data files")
+		}
+	}
+	return tables
 }
 
 func isDataFile(category Filetype) bool {
@@ -308,37 +437,51 @@ func filetype(filename string) (Filetype, int, error) {
 }
 
 func appendMetadata(tables TableMap, table string, directory string, filename string, filetype Filetype, chunkId int) error {
+	loc := fileLocation{
+		table:     table,
+		key:       directory,
+		directory: directory,
+		filename:  filename,
+		ftype:     filetype,
+		chunkId:   chunkId,
+	}
+	return appendLocation(tables, loc)
+}
 
-	var err error
-	t := tables[table]
+// appendLocation adds a data file to the data entry of its location
+func appendLocation(tables TableMap, loc fileLocation) error {
 
+	var err error
+	table := loc.table
 	t, ok := tables[table]
 	if !ok {
 		t = *newDataSpec()
 	}
 
-	d := t.DataMap[directory]
+	d := t.DataMap[loc.key]
 
 	if len(d.Directory) == 0 {
-		d.Directory = directory
+		d.Directory = loc.directory
+		d.FilePrefix = loc.prefix
+		d.Identifiers = loc.identifiers
 	}
 
-	switch filetype {
+	switch loc.ftype {
 	case Chunk:
-		d.Chunks = append(d.Chunks, chunkId)
+		d.Chunks = append(d.Chunks, loc.chunkId)
 	case Overlap:
-		d.Overlaps = append(d.Overlaps, chunkId)
+		d.Overlaps = append(d.Overlaps, loc.chunkId)
 	case Csv:
-		d.Files = append(d.Files, filename)
+		d.Files = append(d.Files, loc.filename)
 	case Tsv:
-		d.Files = append(d.Files, filename)
+		d.Files = append(d.Files, loc.filename)
 	default:
-		msg := fmt.Sprintf("Not recognized file %s", filepath.Join(directory, filename))
+		msg := fmt.Sprintf("Not recognized file %s", loc.key+loc.filename)
 		log.Warn().Msg(msg)
 		err = fmt.Errorf(msg)
 	}
 
-	t.DataMap[directory] = d
+	t.DataMap[loc.key] = d
 	tables[table] = t
 
 	return err
@@ -348,17 +491,77 @@ func Cmd(inputDir string, outFile string, cfg Config) {
 
 	log.Info().Str("Path", inputDir).Msg("Analyze data directory")
 
-	metadata := newMetadata(inputDir, cfg)
+	if cfg.Checksum != "" {
+		_, err := newHash(cfg.Checksum)
+		if err != nil {
+			log.Fatal().AnErr("Checksum", err).Msg("Error in configuration")
+		}
+		if isArchive(inputDir) {
+			log.Fatal().Str("Path", inputDir).Msg("Error in configuration: checksum manifest requires a data directory, extract the archive first")
+		}
+	}
 
-	log.Info().Str("Path", outFile).Msg("Generate JSON file")
+	cfg.report = newReport(cfg.Strict)
+	tables := scan(inputDir, cfg)
+	if cfg.ProvenanceFile != "" || cfg.hasProvenanceFilter() {
+		entries, removedTables, err := selectProvenance(tables, cfg)
+		if err != nil {
+			log.Fatal().AnErr("Provenance", err).Msg("Error while selecting data entries")
+		}
+		var orderedTables []string
+		for _, tableName := range cfg.OrderedTables {
+			if !slices.Contains(removedTables, tableName) {
+				orderedTables = append(orderedTables, tableName)
+			}
+		}
+		cfg.OrderedTables = orderedTables
+		if cfg.ProvenanceFile != "" {
+			log.Info().Str("Path", cfg.ProvenanceFile).Msg("Generate provenance report")
+			err = writeProvenance(entries, cfg.ProvenanceFile)
+			if err != nil {
+				log.Fatal().AnErr("Provenance", err).Msg("Error while writing provenance report")
+			}
+		}
+	}
+	// List data files before convert() removes redundant overlaps
+	var files []string
+	if cfg.Checksum != "" {
+		for _, file := range dataFiles(tables) {
+			files = append(files, file.rpath)
+		}
+	}
+	if _, err := orderTables(tables, cfg.OrderedTables); err != nil {
+		cfg.report.add(finding{Code: codeTableOrder, Severity: severityError, Message: err.Error()})
+	}
 
-	f, err := os.Create(outFile)
-	if err != nil {
-		panic(err)
+	written := false
+	if cfg.report.count(severityError) == 0 {
+		log.Info().Str("Path", outFile).Bool("Compact", cfg.Compact).Msg("Generate JSON file")
+		err := writeMetadata(tables, outFile, cfg)
+		if cfg.report.count(severityError) == 0 {
+			check(err)
+		}
+		written = err == nil
+	}
+
+	if written && cfg.Checksum != "" {
+		manifestFile := manifestPath(outFile, cfg.Checksum)
+		log.Info().Str("Path", manifestFile).Str("Algorithm", cfg.Checksum).Msg("Generate checksum manifest")
+		err := writeManifest(inputDir, files, manifestFile, cfg)
+		if err != nil {
+			log.Fatal().AnErr("Checksum", err).Msg("Error while generating checksum manifest")
+		}
+	}
+
+	cfg.report.writeSummary(os.Stdout)
+	if cfg.ReportFile != "" {
+		log.Info().Str("Path", cfg.ReportFile).Msg("Generate validation report")
+		err := cfg.report.write(cfg.ReportFile)
+		if err != nil {
+			log.Fatal().AnErr("Report", err).Msg("Error while writing validation report")
+		}
+	}
+	if errCount := cfg.report.count(severityError); errCount != 0 {
+		log.Fatal().Int("Errors", errCount).Bool("Strict", cfg.Strict).Msg("Error: data failed validation, metadata file not written")
 	}
-	defer f.Close()
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	err = enc.Encode(metadata)
-	check(err)
 }
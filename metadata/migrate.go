@@ -0,0 +1,225 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Convert metadata.json files between format versions, to upgrade files written by older releases
+// and to feed older releases of qserv-ingest.
+//
+// Format versions, as read by qserv-ingest:
+//
+//	12  Format read by qserv-ingest, also assumed for files without version: the database JSON file,
+//	    the file formats, and for each table its schema, index files and data entries, which list
+//	    the chunk, overlap and regular files of a directory.
+//	13  Data entries gain a file prefix, for flat layouts where data files are named
+//	    <directory><file_prefix><file>, like Object/Object_chunk_1.txt, and the identifiers
+//	    extracted from their path by the path template.
+//
+// Transforms:
+//
+//	12 -> 13  Fields are unchanged. Unknown fields, like a file prefix in a file without version, are rejected.
+//	13 -> 12  The file prefix is prepended to the regular file names and identifiers are dropped.
+//	          Chunk and overlap files with a file prefix can not be described with version 12,
+//	          as chunk file names are fixed, and fail the conversion.
+
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+// MetadataVersion is the latest version of the metadata.json format
+const MetadataVersion = 13
+
+// Oldest version supported by migrations, assumed for files without version
+const legacyVersion = 12
+
+// formatVersion returns the version written for tables: the legacy one, unless a data entry has a file prefix or identifiers
+func formatVersion(tables TableMap) int {
+	for _, spec := range tables {
+		for _, d := range spec.DataMap {
+			if d.FilePrefix != "" || len(d.Identifiers) != 0 {
+				return MetadataVersion
+			}
+		}
+	}
+	return legacyVersion
+}
+
+// format is the dialect of data files, like {"fields_terminated_by": ","}
+type format map[string]string
+
+// metadataV12 is the format version 12 of metadata.json
+type metadataV12 struct {
+	Version  int               `json:"version"`
+	Database string            `json:"database"`
+	Formats  map[string]format `json:"formats,omitempty"`
+	Tables   []tableV12        `json:"tables"`
+}
+
+type tableV12 struct {
+	Schema  string    `json:"schema"`
+	Indexes []string  `json:"indexes,omitempty"`
+	Data    []dataV12 `json:"data"`
+}
+
+type dataV12 struct {
+	Directory string   `json:"directory"`
+	Chunks    []int    `json:"chunks,omitempty"`
+	Overlaps  []int    `json:"overlaps,omitempty"`
+	Files     []string `json:"files,omitempty"`
+}
+
+// migration converts metadata from a version to the next one, and back
+type migration struct {
+	from int
+	up   func(content []byte) ([]byte, error)
+	down func(content []byte) ([]byte, error)
+}
+
+var migrations = []migration{
+	{from: 12, up: upgradeV12, down: downgradeV13},
+}
+
+// upgradeV12 converts metadata from version 12 to 13
+func upgradeV12(content []byte) ([]byte, error) {
+	var in metadataV12
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return nil, fmt.Errorf("invalid version 12 metadata: %v", err)
+	}
+	out := metadata{Version: 13, Database: in.Database, Formats: in.Formats, Tables: make([]table, 0, len(in.Tables))}
+	for _, t := range in.Tables {
+		dataList := make([]data, 0, len(t.Data))
+		for _, d := range t.Data {
+			dataList = append(dataList, data{Directory: d.Directory, Chunks: d.Chunks, Overlaps: d.Overlaps, Files: d.Files})
+		}
+		out.Tables = append(out.Tables, table{Schema: t.Schema, Indexes: t.Indexes, Data: dataList})
+	}
+	return json.Marshal(out)
+}
+
+// downgradeV13 converts metadata from version 13 to 12
+func downgradeV13(content []byte) ([]byte, error) {
+	var in metadata
+	if err := json.Unmarshal(content, &in); err != nil {
+		return nil, err
+	}
+	out := metadataV12{Version: 12, Database: in.Database, Formats: in.Formats, Tables: make([]tableV12, 0, len(in.Tables))}
+	for _, t := range in.Tables {
+		dataList := make([]dataV12, 0, len(t.Data))
+		for _, d := range t.Data {
+			if d.FilePrefix != "" && (len(d.Chunks) != 0 || len(d.Overlaps) != 0) {
+				return nil, fmt.Errorf("table %q, directory %q: chunk files with prefix %q are not supported by version 12",
+					t.Schema, d.Directory, d.FilePrefix)
+			}
+			if len(d.Identifiers) != 0 {
+				log.Warn().Str("Schema", t.Schema).Str("Directory", d.Directory).Interface("Identifiers", d.Identifiers).Msg("Identifiers dropped")
+			}
+			var files []string
+			for _, f := range d.Files {
+				files = append(files, d.FilePrefix+f)
+			}
+			dataList = append(dataList, dataV12{Directory: d.Directory, Chunks: d.Chunks, Overlaps: d.Overlaps, Files: files})
+		}
+		out.Tables = append(out.Tables, tableV12{Schema: t.Schema, Indexes: t.Indexes, Data: dataList})
+	}
+	return json.Marshal(out)
+}
+
+// readVersion returns the format version of metadata, files without version having the legacy version
+func readVersion(content []byte) (int, error) {
+	var v struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(content, &v); err != nil {
+		return 0, err
+	}
+	if v.Version == nil {
+		return legacyVersion, nil
+	}
+	return *v.Version, nil
+}
+
+// checkVersion returns an error if metadata can not be converted from or to version
+func checkVersion(version int) error {
+	if version < legacyVersion || version > MetadataVersion {
+		return fmt.Errorf("unsupported metadata version %d, supported versions are %d to %d", version, legacyVersion, MetadataVersion)
+	}
+	return nil
+}
+
+// migrate converts metadata to version target, applying the migrations of the intermediate versions,
+// and returns the converted metadata with its original version
+func migrate(content []byte, target int) ([]byte, int, error) {
+	version, err := readVersion(content)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := checkVersion(version); err != nil {
+		return nil, version, err
+	}
+	if err := checkVersion(target); err != nil {
+		return nil, version, err
+	}
+	for v := version; v != target; {
+		if v < target {
+			content, err = migrations[v-legacyVersion].up(content)
+			v++
+		} else {
+			content, err = migrations[v-1-legacyVersion].down(content)
+			v--
+		}
+		if err != nil {
+			return nil, version, fmt.Errorf("from version %d: %v", v, err)
+		}
+	}
+	return content, version, nil
+}
+
+// Migrate converts inFile to version, or to MetadataVersion if version is 0, and writes it to outFile
+func Migrate(inFile string, outFile string, version int, cfg Config) {
+	if version == 0 {
+		version = MetadataVersion
+	}
+	content, err := os.ReadFile(inFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error while reading metadata file")
+	}
+	content, from, err := migrate(content, version)
+	if err != nil {
+		log.Fatal().Err(fmt.Errorf("in file %q: %v", inFile, err)).Msg("Error while migrating metadata file")
+	}
+	if !cfg.Compact {
+		var out bytes.Buffer
+		check(json.Indent(&out, content, "", jsonIndent))
+		content = out.Bytes()
+	}
+	if err := os.WriteFile(outFile, append(content, '\n'), 0644); err != nil {
+		log.Fatal().Err(err).Msg("Error while writing metadata file")
+	}
+	log.Info().Str("Path", outFile).Int("From", from).Int("To", version).Msg("Metadata file migrated")
+}
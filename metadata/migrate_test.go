@@ -0,0 +1,118 @@
+package metadata
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMigrateRoundTrip check upgraded then downgraded files are unchanged, files without version having version 12
+func TestMigrateRoundTrip(t *testing.T) {
+	for _, file := range []string{"../dbbench/metadata.json", "../itest/case01/metadata.json"} {
+		content, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		upgraded, from, err := migrate(content, MetadataVersion)
+		assert.NoError(t, err)
+		assert.Equal(t, 12, from, file)
+		version, err := readVersion(upgraded)
+		assert.NoError(t, err)
+		assert.Equal(t, MetadataVersion, version)
+
+		downgraded, from, err := migrate(upgraded, 12)
+		assert.NoError(t, err)
+		assert.Equal(t, MetadataVersion, from)
+		var expected, got map[string]interface{}
+		assert.NoError(t, json.Unmarshal(content, &expected))
+		assert.NoError(t, json.Unmarshal(downgraded, &got))
+		expected["version"] = float64(12)
+		// Empty index lists are equivalent to missing ones
+		for _, tbl := range expected["tables"].([]interface{}) {
+			if indexes, ok := tbl.(map[string]interface{})["indexes"]; ok && len(indexes.([]interface{})) == 0 {
+				delete(tbl.(map[string]interface{}), "indexes")
+			}
+		}
+		assert.Equal(t, expected, got, file)
+	}
+}
+
+func TestUpgradeV12(t *testing.T) {
+	content := `{"database": "db.json", "tables": [{"schema": "Object.json", "indexes": [],
+		"data": [{"directory": "Object/", "chunks": [1], "overlaps": [1]}]}]}`
+	upgraded, _, err := migrate([]byte(content), 13)
+	assert.NoError(t, err)
+	var m metadata
+	assert.NoError(t, json.Unmarshal(upgraded, &m))
+	expected := metadata{
+		Version:  13,
+		Database: "db.json",
+		Tables:   []table{{Schema: "Object.json", Data: []data{{Directory: "Object/", Chunks: []int{1}, Overlaps: []int{1}}}}},
+	}
+	assert.Equal(t, expected, m)
+
+	content = `{"database": "db.json", "tables": [{"schema": "Object.json",
+		"data": [{"directory": "Object/", "file_prefix": "Object_", "chunks": [1]}]}]}`
+	_, _, err = migrate([]byte(content), 13)
+	assert.Error(t, err, "Version 13 fields should not be dropped from files without version")
+}
+
+func TestDowngradeV13(t *testing.T) {
+	m := metadata{
+		Version:  13,
+		Database: "db.json",
+		Tables: []table{
+			{Schema: "Filter.json", Indexes: []string{"idx_Filter.json"}, Data: []data{
+				{Directory: "run1/", FilePrefix: "Filter_", Identifiers: map[string]string{"run": "run1"}, Files: []string{"a.csv", "b.csv"}},
+			}},
+			{Schema: "Object.json", Data: []data{{Directory: "Object/", Chunks: []int{1}}}},
+		},
+	}
+	content, err := json.Marshal(m)
+	assert.NoError(t, err)
+	downgraded, _, err := migrate(content, 12)
+	assert.NoError(t, err)
+	var m12 metadataV12
+	assert.NoError(t, json.Unmarshal(downgraded, &m12))
+	expected := metadataV12{
+		Version:  12,
+		Database: "db.json",
+		Tables: []tableV12{
+			{Schema: "Filter.json", Indexes: []string{"idx_Filter.json"}, Data: []dataV12{{Directory: "run1/", Files: []string{"Filter_a.csv", "Filter_b.csv"}}}},
+			{Schema: "Object.json", Data: []dataV12{{Directory: "Object/", Chunks: []int{1}}}},
+		},
+	}
+	assert.Equal(t, expected, m12)
+
+	m.Tables[1].Data[0].FilePrefix = "Object_"
+	content, err = json.Marshal(m)
+	assert.NoError(t, err)
+	_, _, err = migrate(content, 12)
+	assert.Error(t, err, "Chunk files with a prefix can not be downgraded")
+}
+
+func TestMigrateVersions(t *testing.T) {
+	_, _, err := migrate([]byte(`{"version": 11, "database": "db.json", "tables": []}`), MetadataVersion)
+	assert.Error(t, err)
+	_, _, err = migrate([]byte(`{"version": 12, "database": "db.json", "tables": []}`), MetadataVersion+1)
+	assert.Error(t, err)
+	content := []byte(`{"version": 13, "database": "db.json", "tables": []}`)
+	out, from, err := migrate(content, 13)
+	assert.NoError(t, err)
+	assert.Equal(t, 13, from)
+	assert.Equal(t, content, out)
+}
+
+// TestFormatVersion check version 13 is only written for data entries with a file prefix or identifiers
+func TestFormatVersion(t *testing.T) {
+	tables := make(TableMap)
+	assert.NoError(t, addDataFile(tables, "Object/DIR1/chunk_1.txt", "Object/DIR1/chunk_1.txt"))
+	assert.Equal(t, legacyVersion, formatVersion(tables))
+	assert.Equal(t, legacyVersion, convert(tables, nil).Version)
+
+	d := tables["Object"].DataMap["Object/DIR1/"]
+	d.Identifiers = map[string]string{"run": "r1"}
+	tables["Object"].DataMap["Object/DIR1/"] = d
+	assert.Equal(t, MetadataVersion, formatVersion(tables))
+	assert.Equal(t, MetadataVersion, convert(tables, nil).Version)
+}
@@ -0,0 +1,243 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Extract tract, step and timestamp provenance from directory names, like
+// diaObjectTable_tract_2897_DC2_2_2i_runs_DP0_2_v23_0_2_PREOPS-905_step5_1_20220503T191629Z,
+// and select data entries with it
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+)
+
+// Names of the provenance attributes used to select data entries
+const (
+	provenanceTract     = "tract"
+	provenanceStep      = "step"
+	provenanceTimestamp = "timestamp"
+)
+
+// TimestampLayout is the layout of timestamps in PREOPS-905 directory names
+const TimestampLayout = "20060102T150405Z"
+
+// DefaultProvenancePatterns extract tract, step and timestamp from PREOPS-905 directory names
+var DefaultProvenancePatterns = []string{
+	`_tract_(?P<tract>[0-9]+)(?:_|$)`,
+	`_(?P<step>step[0-9]+(?:_[0-9]+)?)_`,
+	`_(?P<timestamp>[0-9]{8}T[0-9]{6}Z)$`,
+}
+
+// provenanceEntry is the provenance of a data entry, as written in the provenance report
+type provenanceEntry struct {
+	Table      string            `json:"table"`
+	Directory  string            `json:"directory"`
+	FilePrefix string            `json:"file_prefix,omitempty"`
+	Provenance map[string]string `json:"provenance"`
+	Selected   bool              `json:"selected"`
+}
+
+// ParseTime parses a time window bound, given as a PREOPS-905 timestamp, a RFC3339 time or a date
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{TimestampLayout, time.RFC3339, "2006-01-02"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use %s, %s or 2006-01-02", s, TimestampLayout, time.RFC3339)
+}
+
+// compileProvenancePatterns compiles patterns, or DefaultProvenancePatterns if empty, named groups being attributes
+func compileProvenancePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		patterns = DefaultProvenancePatterns
+	}
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid provenance pattern %q: %v", p, err)
+		}
+		named := false
+		for _, name := range re.SubexpNames() {
+			named = named || name != ""
+		}
+		if !named {
+			return nil, fmt.Errorf("provenance pattern %q has no named group, like (?P<tract>[0-9]+)", p)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// hasProvenanceFilter returns true if the configuration selects data entries by provenance
+func (cfg Config) hasProvenanceFilter() bool {
+	return len(cfg.Tracts) != 0 || len(cfg.Steps) != 0 || !cfg.After.IsZero() || !cfg.Before.IsZero()
+}
+
+// extractProvenance returns the provenance of a data entry from its identifiers and from patterns
+func extractProvenance(d data, patterns []*regexp.Regexp) map[string]string {
+	p := make(map[string]string)
+	for k, v := range d.Identifiers {
+		p[k] = v
+	}
+	components := strings.Split(strings.Trim(d.Directory, "/"), "/")
+	if d.FilePrefix != "" {
+		components = append(components, d.FilePrefix)
+	}
+	for _, re := range patterns {
+		for _, c := range components {
+			m := re.FindStringSubmatch(c)
+			if m == nil {
+				continue
+			}
+			for i, name := range re.SubexpNames() {
+				if name != "" && m[i] != "" {
+					p[name] = m[i]
+				}
+			}
+		}
+	}
+	return p
+}
+
+// selected returns true if p matches the filters of cfg, filters on attributes missing from p being skipped and returned
+func selected(p map[string]string, cfg Config) (bool, []string, error) {
+	var missing []string
+	if len(cfg.Tracts) != 0 {
+		tract, ok := p[provenanceTract]
+		if !ok {
+			missing = append(missing, provenanceTract)
+		} else if !slices.Contains(cfg.Tracts, tract) {
+			return false, missing, nil
+		}
+	}
+	if len(cfg.Steps) != 0 {
+		step, ok := p[provenanceStep]
+		if !ok {
+			missing = append(missing, provenanceStep)
+		} else if _, ok := matchAny(cfg.Steps, step); !ok {
+			return false, missing, nil
+		}
+	}
+	if cfg.After.IsZero() && cfg.Before.IsZero() {
+		return true, missing, nil
+	}
+	ts, ok := p[provenanceTimestamp]
+	if !ok {
+		return true, append(missing, provenanceTimestamp), nil
+	}
+	t, err := time.Parse(TimestampLayout, ts)
+	if err != nil {
+		return false, missing, fmt.Errorf("invalid timestamp %q: %v", ts, err)
+	}
+	if !cfg.After.IsZero() && t.Before(cfg.After) {
+		return false, missing, nil
+	}
+	if !cfg.Before.IsZero() && !t.Before(cfg.Before) {
+		return false, missing, nil
+	}
+	return true, missing, nil
+}
+
+// selectProvenance removes the data entries of tables which do not match the filters of cfg, and returns the removed empty tables
+func selectProvenance(tables TableMap, cfg Config) ([]provenanceEntry, []string, error) {
+	patterns, err := compileProvenancePatterns(cfg.ProvenancePatterns)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []provenanceEntry
+	var removedTables []string
+	removed := 0
+	for tableName, spec := range tables {
+		unfiltered := make(map[string]int)
+		for key, d := range spec.DataMap {
+			p := extractProvenance(d, patterns)
+			ok, missing, err := selected(p, cfg)
+			if err != nil {
+				return nil, nil, fmt.Errorf("in directory %q: %v", key, err)
+			}
+			for _, name := range missing {
+				unfiltered[name]++
+			}
+			entries = append(entries, provenanceEntry{
+				Table:      tableName,
+				Directory:  d.Directory,
+				FilePrefix: d.FilePrefix,
+				Provenance: p,
+				Selected:   ok,
+			})
+			if !ok {
+				log.Debug().Str("Table", tableName).Str("Directory", key).Msg("Data entry not selected")
+				delete(spec.DataMap, key)
+				removed++
+			}
+		}
+		for name, count := range unfiltered {
+			cfg.report.add(finding{
+				Code:     codeProvenanceNotFound,
+				Severity: severityWarning,
+				Table:    tableName,
+				Message:  fmt.Sprintf("No %s found in %d data entries, filter not applied", name, count),
+			})
+		}
+		if len(spec.DataMap) == 0 {
+			log.Info().Str("Table", tableName).Msg("No selected data entry, table removed")
+			delete(tables, tableName)
+			removedTables = append(removedTables, tableName)
+		}
+	}
+	if cfg.hasProvenanceFilter() {
+		log.Info().Int("Selected", len(entries)-removed).Int("Removed", removed).Msg("Select data entries by provenance")
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Table != entries[j].Table {
+			return entries[i].Table < entries[j].Table
+		}
+		return path.Join(entries[i].Directory, entries[i].FilePrefix) < path.Join(entries[j].Directory, entries[j].FilePrefix)
+	})
+	sort.Strings(removedTables)
+	return entries, removedTables, nil
+}
+
+// writeProvenance writes the provenance report of data entries to outFile
+func writeProvenance(entries []provenanceEntry, outFile string) error {
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outFile, append(content, '\n'), 0644)
+}
@@ -0,0 +1,92 @@
+package metadata
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Data files in directories named like PREOPS-905 ones
+var preopsFiles = []string{
+	"DiaObject/chunks/diaObjectTable_tract_2897_DC2_2_2i_runs_DP0_2_v23_0_2_PREOPS-905_step5_1_20220503T191629Z/chunk_1.txt",
+	"DiaObject/chunks/diaObjectTable_tract_2898_DC2_2_2i_runs_DP0_2_v23_0_2_PREOPS-905_step5_1_20220503T191629Z/chunk_1.txt",
+	"DiaObject/chunks/diaObjectTable_tract_3074_DC2_2_2i_runs_DP0_2_v23_0_2_PREOPS-905_step5_4_20220505T233000Z/chunk_2.txt",
+	"Source/chunks/calibratedSourceTable_visit_LSSTCam-imSim_g_g_sim_1_4_1016776_2_2i_runs_DP0_2_v23_0_2_PREOPS-905_step6_16_20220514T201929Z/chunk_1.txt",
+	"Source/chunks/calibratedSourceTable_visit_LSSTCam-imSim_g_g_sim_1_4_1016777_2_2i_runs_DP0_2_v23_0_2_PREOPS-905_step6_1_20220512T201515Z/chunk_2.txt",
+}
+
+// preopsTables returns data entries named like PREOPS-905 directories
+func preopsTables(t *testing.T) TableMap {
+	tables := make(TableMap)
+	for _, rpath := range preopsFiles {
+		assert.NoError(t, addDataFile(tables, rpath, rpath))
+	}
+	return tables
+}
+
+// TestExtractProvenance check tract, step and timestamp are extracted from PREOPS-905 directory names
+func TestExtractProvenance(t *testing.T) {
+	patterns, err := compileProvenancePatterns(nil)
+	assert.NoError(t, err)
+	d := data{
+		Directory:   "DiaObject/chunks/diaObjectTable_tract_2897_DC2_2_2i_runs_DP0_2_v23_0_2_PREOPS-905_step5_1_20220503T191629Z/",
+		Identifiers: map[string]string{"release": "dp02"},
+	}
+	expected := map[string]string{"release": "dp02", "tract": "2897", "step": "step5_1", "timestamp": "20220503T191629Z"}
+	assert.Equal(t, expected, extractProvenance(d, patterns))
+
+	_, err = compileProvenancePatterns([]string{`_tract_[0-9]+`})
+	assert.Error(t, err, "Patterns without named group should be rejected")
+}
+
+// TestSelectProvenance check data entries are selected by tract, step and time window
+func TestSelectProvenance(t *testing.T) {
+	tables := preopsTables(t)
+	cfg := Config{Steps: []string{"step5_*"}, Tracts: []string{"2897", "3074"}}
+	entries, removedTables, err := selectProvenance(tables, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Source"}, removedTables)
+	assert.Len(t, entries, 5)
+	assert.False(t, entries[1].Selected)
+	assert.Len(t, tables["DiaObject"].DataMap, 2)
+	assert.NotContains(t, tables, "Source", "Source steps do not match, tract filter being not applied")
+
+	tables = preopsTables(t)
+	cfg = Config{Tracts: []string{"2897"}}
+	_, removedTables, err = selectProvenance(tables, cfg)
+	assert.Empty(t, removedTables)
+	assert.NoError(t, err)
+	assert.Len(t, tables["DiaObject"].DataMap, 1)
+	assert.Len(t, tables["Source"].DataMap, 2, "Tract filter should not apply to entries without tract")
+
+	after, err := ParseTime("20220514T000000Z")
+	assert.NoError(t, err)
+	tables = preopsTables(t)
+	cfg = Config{After: after, Before: after.Add(24 * time.Hour)}
+	_, _, err = selectProvenance(tables, cfg)
+	assert.NoError(t, err)
+	assert.NotContains(t, tables, "DiaObject")
+	assert.Len(t, tables["Source"].DataMap, 1)
+
+	_, err = ParseTime("2022-05-14T00:00")
+	assert.Error(t, err)
+}
+
+// TestCmdProvenanceOrder check tables removed by the provenance selection are removed from the ingest order
+func TestCmdProvenanceOrder(t *testing.T) {
+	inputDir := t.TempDir()
+	files := make(map[string]string)
+	for _, rpath := range preopsFiles {
+		files[rpath] = "1\n"
+	}
+	addTestFiles(t, inputDir, nil, files)
+	outFile := filepath.Join(t.TempDir(), "metadata.json")
+	Cmd(inputDir, outFile, Config{Steps: []string{"step5_*"}, OrderedTables: []string{"DiaObject", "Source"}})
+
+	m, err := loadMetadata(outFile)
+	assert.NoError(t, err)
+	assert.Len(t, m.Tables, 1)
+	assert.Equal(t, "DiaObject.json", m.Tables[0].Schema)
+}
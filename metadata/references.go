@@ -0,0 +1,184 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Check that rows of child tables reference existing director rows, located in the same chunk
+
+package metadata
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/fjammes/qserv-tools/v2/schema"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum number of orphan rows reported for each table
+const maxOrphans = 100
+
+// orphan is a child row whose director row does not exist, or is located in another chunk
+type orphan struct {
+	rpath   string
+	line    int
+	key     string
+	chunkId int
+	// Chunk of the director row, -1 if it does not exist
+	directorChunkId int
+}
+
+// refCheck is the result of checking the references of a child table
+type refCheck struct {
+	rows      int
+	missing   int
+	misplaced int
+	// At most maxOrphans orphan rows, the first ones found in shard order, sorted by file and line
+	orphans []orphan
+}
+
+// isChild returns true if the table is partitioned and references a director table
+func isChild(t *schema.Table) bool {
+	return t.IsPartitioned == 1 && t.DirectorTable != ""
+}
+
+// tableOrphans checks that the director key of each row of a child table exists in the same chunk of its director
+func tableOrphans(inputDir string, tables TableMap, schemas map[string]*schema.Table, table string, cfg Config) (refCheck, error) {
+	var res refCheck
+	child := schemas[table]
+	director := schemas[child.DirectorTable]
+	if director == nil {
+		return res, fmt.Errorf("director table %q of table %q has no data or schema", child.DirectorTable, table)
+	}
+
+	directorShards, err := newKeyShards(cfg)
+	if err != nil {
+		return res, err
+	}
+	defer directorShards.remove()
+	childShards, err := newKeyShards(cfg)
+	if err != nil {
+		return res, err
+	}
+	defer childShards.remove()
+
+	directorKey := func(t *schema.Table) string {
+		return t.DirectorKey
+	}
+	err = collectKeys(inputDir, tableChunkFiles(tables, director.Table), schemas, directorKey, directorShards, cfg)
+	if err != nil {
+		return res, err
+	}
+	childFiles := tableChunkFiles(tables, table)
+	err = collectKeys(inputDir, childFiles, schemas, directorKey, childShards, cfg)
+	if err != nil {
+		return res, err
+	}
+
+	for i := 0; i < directorShards.size(); i++ {
+		directorChunks := make(map[string]int)
+		err := directorShards.read(i, func(r keyRecord) {
+			directorChunks[r.key] = r.chunkId
+		})
+		if err != nil {
+			return res, err
+		}
+		err = childShards.read(i, func(r keyRecord) {
+			res.rows++
+			directorChunkId, ok := directorChunks[r.key]
+			if !ok {
+				res.missing++
+				directorChunkId = -1
+			} else if directorChunkId != r.chunkId {
+				res.misplaced++
+			} else {
+				return
+			}
+			if len(res.orphans) < maxOrphans {
+				o := orphan{rpath: childFiles[r.file].rpath, line: r.line, key: r.key, chunkId: r.chunkId, directorChunkId: directorChunkId}
+				res.orphans = append(res.orphans, o)
+			}
+		})
+		if err != nil {
+			return res, err
+		}
+	}
+	sort.Slice(res.orphans, func(i, j int) bool {
+		if res.orphans[i].rpath != res.orphans[j].rpath {
+			return res.orphans[i].rpath < res.orphans[j].rpath
+		}
+		return res.orphans[i].line < res.orphans[j].line
+	})
+	return res, nil
+}
+
+// CheckReferences checks that each row of the child tables references a director row in the same chunk
+func CheckReferences(inputDir string, cfg Config) {
+
+	if isArchive(inputDir) {
+		log.Fatal().Str("Path", inputDir).Msg("Error: archives are not supported, use extraction first")
+	}
+	schemaDir := cfg.SchemaDir
+	if schemaDir == "" {
+		schemaDir = inputDir
+	}
+	log.Info().Str("Path", inputDir).Str("Schemas", schemaDir).Msg("Check references to director tables")
+
+	tables := scan(inputDir, cfg)
+	schemas, err := loadSchemas(tables, schemaDir)
+	if err != nil {
+		log.Fatal().AnErr("Schema", err).Msg("Error while loading table schemas")
+	}
+
+	tableNames := make([]string, 0, len(tables))
+	for table := range tables {
+		tableNames = append(tableNames, table)
+	}
+	sort.Strings(tableNames)
+	errCount := 0
+	for _, table := range tableNames {
+		t := schemas[table]
+		if !isChild(t) {
+			continue
+		}
+		res, err := tableOrphans(inputDir, tables, schemas, table, cfg)
+		if err != nil {
+			log.Error().Str("Table", table).AnErr("Error", err).Msg("Unable to check references")
+			errCount++
+			continue
+		}
+		for _, o := range res.orphans {
+			msg := "Director row not found"
+			if o.directorChunkId != -1 {
+				msg = "Director row located in another chunk"
+			}
+			log.Error().Str("Table", table).Str("File", o.rpath).Int("Line", o.line).Str("Key", o.key).Int("Chunk", o.chunkId).Int("DirectorChunk", o.directorChunkId).Msg(msg)
+		}
+		if res.missing+res.misplaced > len(res.orphans) {
+			log.Error().Str("Table", table).Int("Orphans", res.missing+res.misplaced).Msg("Too many orphan rows, only first ones are reported")
+		}
+		log.Info().Str("Table", table).Str("Director", t.DirectorTable).Int("Rows", res.rows).Int("Missing", res.missing).Int("Misplaced", res.misplaced).Msg("References checked")
+		errCount += res.missing + res.misplaced
+	}
+	if errCount != 0 {
+		log.Fatal().Int("Errors", errCount).Msg("Error: invalid references to director tables")
+	}
+	log.Info().Msg("All child rows reference director rows in the same chunk")
+}
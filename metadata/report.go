@@ -0,0 +1,149 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Collect the findings of metadata generation into a validation report, written as JSON and summarized
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+)
+
+type severity string
+
+const (
+	severityInfo    severity = "info"
+	severityWarning severity = "warning"
+	severityError   severity = "error"
+)
+
+// Codes of the findings of metadata generation
+const (
+	codeOverlapsRemoved    = "overlaps-removed"
+	codeTableNoData        = "table-no-data"
+	codeTableMixedData     = "table-mixed-data"
+	codeTableOrder         = "table-order"
+	codeFileIgnored        = "file-ignored"
+	codeFileUnknown        = "file-unknown"
+	codeFileIntegrity      = "file-integrity"
+	codeProvenanceNotFound = "provenance-not-found"
+)
+
+// finding is an issue, or a change, found while generating metadata
+type finding struct {
+	Code     string   `json:"code"`
+	Severity severity `json:"severity"`
+	Table    string   `json:"table,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// report collects findings, warnings being errors in strict mode, a nil report only logging them
+type report struct {
+	strict   bool
+	findings []finding
+}
+
+func newReport(strict bool) *report {
+	return &report{strict: strict}
+}
+
+// add logs a finding and records it
+func (r *report) add(f finding) {
+	if r != nil && r.strict && f.Severity == severityWarning {
+		f.Severity = severityError
+	}
+	event := log.Info()
+	switch f.Severity {
+	case severityWarning:
+		event = log.Warn()
+	case severityError:
+		event = log.Error()
+	}
+	event.Str("Code", f.Code).Str("Table", f.Table).Str("Path", f.Path).Msg(f.Message)
+	if r != nil {
+		r.findings = append(r.findings, f)
+	}
+}
+
+// count returns the number of findings with severity s
+func (r *report) count(s severity) int {
+	n := 0
+	for _, f := range r.findings {
+		if f.Severity == s {
+			n++
+		}
+	}
+	return n
+}
+
+// write writes the report as JSON to outFile
+func (r *report) write(outFile string) error {
+	findings := r.findings
+	if findings == nil {
+		findings = []finding{}
+	}
+	content, err := json.MarshalIndent(struct {
+		Strict   bool      `json:"strict"`
+		Errors   int       `json:"errors"`
+		Warnings int       `json:"warnings"`
+		Findings []finding `json:"findings"`
+	}{r.strict, r.count(severityError), r.count(severityWarning), findings}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outFile, append(content, '\n'), 0644)
+}
+
+// writeSummary writes the number of findings by severity and code
+func (r *report) writeSummary(w io.Writer) {
+	type group struct {
+		severity severity
+		code     string
+	}
+	counts := make(map[group]int)
+	for _, f := range r.findings {
+		counts[group{f.Severity, f.Code}]++
+	}
+	groups := make([]group, 0, len(counts))
+	for g := range counts {
+		groups = append(groups, g)
+	}
+	rank := map[severity]int{severityError: 0, severityWarning: 1, severityInfo: 2}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].severity != groups[j].severity {
+			return rank[groups[i].severity] < rank[groups[j].severity]
+		}
+		return groups[i].code < groups[j].code
+	})
+	fmt.Fprintf(w, "Validation report: %d errors, %d warnings, %d infos\n",
+		r.count(severityError), r.count(severityWarning), r.count(severityInfo))
+	for _, g := range groups {
+		fmt.Fprintf(w, "  %-8s %-22s %d\n", g.severity, g.code, counts[g])
+	}
+}
@@ -0,0 +1,74 @@
+package metadata
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReport check findings of metadata generation are collected, and promoted to errors in strict mode
+func TestReport(t *testing.T) {
+	tables := TableMap{
+		"Object": DataSpec{DataMap: map[string]data{
+			"Object/DIR1/": {Directory: "Object/DIR1/", Chunks: []int{1}, Overlaps: []int{1}},
+			"Object/DIR2/": {Directory: "Object/DIR2/", Files: []string{"Object.csv"}},
+		}},
+		"Filter": DataSpec{DataMap: map[string]data{}},
+	}
+	rep := newReport(false)
+	for tableName := range tables {
+		finalizeTable(tableName, tables[tableName], rep)
+	}
+	expected := []finding{
+		{Code: codeTableNoData, Severity: severityWarning, Table: "Filter", Message: "Table has no data"},
+		{Code: codeOverlapsRemoved, Severity: severityInfo, Table: "Object", Path: "Object/DIR1/", Message: "Remove Overlaps"},
+		{Code: codeTableMixedData, Severity: severityError, Table: "Object", Message: "Table has both chunk files and regular files"},
+	}
+	assert.ElementsMatch(t, expected, rep.findings)
+
+	var summary bytes.Buffer
+	rep.writeSummary(&summary)
+	assert.Equal(t, "Validation report: 1 errors, 1 warnings, 1 infos\n"+
+		"  error    table-mixed-data       1\n"+
+		"  warning  table-no-data          1\n"+
+		"  info     overlaps-removed       1\n", summary.String())
+
+	rep = newReport(true)
+	rep.add(finding{Code: codeFileUnknown, Severity: severityWarning, Path: "README", Message: "Ignored file: not recognized"})
+	assert.Equal(t, 1, rep.count(severityError), "Warnings should be errors in strict mode")
+	outFile := filepath.Join(t.TempDir(), "report.json")
+	assert.NoError(t, rep.write(outFile))
+	content, err := os.ReadFile(outFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"errors": 1`)
+}
+
+// TestIntegrityReport check integrity failures are reported instead of stopping the scan
+func TestIntegrityReport(t *testing.T) {
+	inputDir := t.TempDir()
+	tables := writeTestTree(t, inputDir)
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "Filter", "Filter.csv"), nil, 0644))
+	cfg := Config{FilePolicy: PolicyFail, report: newReport(false)}
+	assert.NoError(t, checkIntegrity(inputDir, tables, cfg))
+	assert.Len(t, cfg.report.findings, 1)
+	assert.Equal(t, severityError, cfg.report.findings[0].Severity)
+	assert.Equal(t, "Filter/Filter.csv", cfg.report.findings[0].Path)
+}
+
+// TestUnknownFileReport check unknown files are reported as errors, which prevent writing metadata
+func TestUnknownFileReport(t *testing.T) {
+	inputDir := t.TempDir()
+	writeTestTree(t, inputDir)
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "README"), nil, 0644))
+	cfg := Config{report: newReport(false)}
+	tables := walkDirs(inputDir, cfg)
+	assert.Len(t, dataFiles(tables), 3)
+	assert.Equal(t, []finding{{Code: codeFileUnknown, Severity: severityError, Path: "README", Message: "Ignored file: not recognized"}}, cfg.report.findings)
+
+	outFile := filepath.Join(t.TempDir(), "metadata.json")
+	assert.Error(t, writeMetadata(tables, outFile, cfg))
+	assert.NoFileExists(t, outFile)
+}
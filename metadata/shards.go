@@ -0,0 +1,196 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Compare key columns of large tables with bounded memory: keys are first spread
+// over temporary shard files by hash, then each shard is processed in memory
+
+package metadata
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/fjammes/qserv-tools/v2/schema"
+)
+
+// Default number of shard files
+const defaultShards = 64
+
+// keyRecord is a key read from a data file, with its location
+type keyRecord struct {
+	key     string
+	chunkId int
+	// Index of the data file in the list passed to collectKeys
+	file int
+	line int
+}
+
+// keyShards spreads key records over temporary files by key hash, all records of a key being in one shard
+type keyShards struct {
+	dir     string
+	files   []*os.File
+	writers []*bufio.Writer
+	locks   []sync.Mutex
+}
+
+// newKeyShards creates cfg.Shards shard files in a temporary directory of cfg.TmpDir
+func newKeyShards(cfg Config) (*keyShards, error) {
+	n := cfg.Shards
+	if n <= 0 {
+		n = defaultShards
+	}
+	dir, err := os.MkdirTemp(cfg.TmpDir, "qserv-keys-")
+	if err != nil {
+		return nil, err
+	}
+	s := keyShards{
+		dir:     dir,
+		files:   make([]*os.File, n),
+		writers: make([]*bufio.Writer, n),
+		locks:   make([]sync.Mutex, n),
+	}
+	for i := range s.files {
+		s.files[i], err = os.Create(filepath.Join(dir, fmt.Sprintf("shard_%d", i)))
+		if err != nil {
+			s.remove()
+			return nil, err
+		}
+		s.writers[i] = bufio.NewWriter(s.files[i])
+	}
+	return &s, nil
+}
+
+// add writes a record to the shard of its key
+func (s *keyShards) add(key []byte, chunkId int, file int, line int) error {
+	i := int(xxhash.Sum64(key) % uint64(len(s.files)))
+	s.locks[i].Lock()
+	defer s.locks[i].Unlock()
+	var buf [4 * binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(key)))
+	n += binary.PutVarint(buf[n:], int64(chunkId))
+	n += binary.PutUvarint(buf[n:], uint64(file))
+	n += binary.PutUvarint(buf[n:], uint64(line))
+	if _, err := s.writers[i].Write(buf[:n]); err != nil {
+		return err
+	}
+	_, err := s.writers[i].Write(key)
+	return err
+}
+
+// read calls fn for each record of shard i
+func (s *keyShards) read(i int, fn func(r keyRecord)) error {
+	if err := s.writers[i].Flush(); err != nil {
+		return err
+	}
+	if _, err := s.files[i].Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	br := bufio.NewReader(s.files[i])
+	for {
+		keyLen, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		chunkId, err := binary.ReadVarint(br)
+		if err != nil {
+			return err
+		}
+		file, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+		line, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+		key := make([]byte, keyLen)
+		if _, err := io.ReadFull(br, key); err != nil {
+			return err
+		}
+		fn(keyRecord{key: string(key), chunkId: int(chunkId), file: int(file), line: int(line)})
+	}
+}
+
+// size returns the number of shards
+func (s *keyShards) size() int {
+	return len(s.files)
+}
+
+// remove deletes the shard files
+func (s *keyShards) remove() {
+	for _, f := range s.files {
+		if f != nil {
+			f.Close()
+		}
+	}
+	os.RemoveAll(s.dir)
+}
+
+// collectKeys adds the non NULL values of a column of data files to shards, with the chunk of their file
+func collectKeys(inputDir string, files []dataFile, schemas map[string]*schema.Table, keyColumn func(t *schema.Table) string, shards *keyShards, cfg Config) error {
+	errs := make([]error, len(files))
+	parallel(len(files), workers(cfg), func(i int) {
+		file := files[i]
+		t := schemas[file.table]
+		name := keyColumn(t)
+		idx := dataColumnIndex(t, name)
+		if idx < 0 {
+			errs[i] = fmt.Errorf("column %q of table %q not found in schema", name, file.table)
+			return
+		}
+		var addErr error
+		line := 0
+		addKey := func(fields [][]byte) (string, string) {
+			line++
+			if idx >= len(fields) || addErr != nil {
+				return "", ""
+			}
+			if string(fields[idx]) != schema.NullValue {
+				addErr = shards.add(fields[idx], file.chunkId, i, line)
+			}
+			return "", ""
+		}
+		res := checkFile(filepath.Join(inputDir, file.rpath), file.rpath, fileDelimiter(file.ftype, cfg), addKey, cfg.SampleRows)
+		errs[i] = res.err
+		if addErr != nil {
+			errs[i] = addErr
+		}
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("in file %q: %v", file.rpath, errs[i])
+		}
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
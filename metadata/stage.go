@@ -0,0 +1,197 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Build a staging tree, following the <table>/<dir>/chunk_N.txt layout, which links the data files
+// of several source directories into a single base directory
+
+package metadata
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CollisionPolicy is the action taken when data entries of sources have the same staged directory
+type CollisionPolicy string
+
+const (
+	// CollisionRename adds a numeric suffix to the staged directory, like <table>/DIR1_2,
+	// data at the root of a table being moved to <table>/<table>_2
+	CollisionRename CollisionPolicy = "rename"
+	// CollisionFail stops the staging
+	CollisionFail CollisionPolicy = "fail"
+)
+
+// ParseCollisionPolicy parses the policy for staged directory collisions: rename or fail
+func ParseCollisionPolicy(s string) (CollisionPolicy, error) {
+	p := CollisionPolicy(s)
+	switch p {
+	case CollisionRename, CollisionFail:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown collision policy %q, use rename or fail", s)
+}
+
+// stagedFile is a data file of a source and its path relative to the staging tree
+type stagedFile struct {
+	src   string
+	rpath string
+}
+
+// stagedKey returns <table>/<dir>/ for a data entry, dir being the last component of its directory if any
+func stagedKey(table string, d data) string {
+	dir := path.Base(strings.TrimSuffix(d.Directory, "/"))
+	if d.Directory == "" || dir == table {
+		return table + "/"
+	}
+	return table + "/" + dir + "/"
+}
+
+// stageTables merges the data entries of sources and returns the files to link, resolving collisions with policy
+func stageTables(sources []string, sourceTables []TableMap, policy CollisionPolicy) (TableMap, []stagedFile, error) {
+	staged := make(TableMap)
+	var files []stagedFile
+	for i, tables := range sourceTables {
+		tableNames := make([]string, 0, len(tables))
+		for tableName := range tables {
+			tableNames = append(tableNames, tableName)
+		}
+		sort.Strings(tableNames)
+		for _, tableName := range tableNames {
+			spec := tables[tableName]
+			keys := make([]string, 0, len(spec.DataMap))
+			for key := range spec.DataMap {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			s, ok := staged[tableName]
+			if !ok {
+				s = *newDataSpec()
+			}
+			for _, key := range keys {
+				d := spec.DataMap[key]
+				dst := stagedKey(tableName, d)
+				if _, exists := s.DataMap[dst]; exists {
+					if policy == CollisionFail {
+						return nil, nil, fmt.Errorf("directory %q of source %q is already staged as %q", key, sources[i], dst)
+					}
+					name := path.Base(dst)
+					for n := 2; exists; n++ {
+						dst = fmt.Sprintf("%s/%s_%d/", tableName, name, n)
+						_, exists = s.DataMap[dst]
+					}
+					log.Info().Str("Source", sources[i]).Str("Directory", key).Str("Staged", dst).Msg("Staged directory renamed")
+				}
+				entry := TableMap{tableName: DataSpec{DataMap: map[string]data{key: d}}}
+				for _, f := range dataFiles(entry) {
+					files = append(files, stagedFile{
+						src:   filepath.Join(sources[i], filepath.FromSlash(f.rpath)),
+						rpath: dst + strings.TrimPrefix(f.rpath, key),
+					})
+				}
+				s.DataMap[dst] = data{
+					Directory:   dst,
+					Identifiers: d.Identifiers,
+					Chunks:      d.Chunks,
+					Overlaps:    d.Overlaps,
+					Files:       d.Files,
+				}
+			}
+			staged[tableName] = s
+		}
+	}
+	return staged, files, nil
+}
+
+// writeStage links files and the schemas of staged tables into outDir, and writes its metadata,
+// outDir being removed on error so that a partial tree is not reused
+func writeStage(outDir string, staged TableMap, files []stagedFile, schemaDir string, mode LinkMode, cfg Config) error {
+	err := linkStage(outDir, staged, files, schemaDir, mode, cfg)
+	if err == nil {
+		err = writeMetadata(staged, filepath.Join(outDir, "metadata.json"), cfg)
+	}
+	if err != nil {
+		os.RemoveAll(outDir)
+	}
+	return err
+}
+
+// linkStage links files and the schemas of staged tables into outDir
+func linkStage(outDir string, staged TableMap, files []stagedFile, schemaDir string, mode LinkMode, cfg Config) error {
+	errs := make([]error, len(files))
+	parallel(len(files), workers(cfg), func(i int) {
+		errs[i] = copyFile(files[i].src, filepath.Join(outDir, filepath.FromSlash(files[i].rpath)), mode)
+	})
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("unable to link data file %q: %v", files[i].src, err)
+		}
+	}
+	return copyAuxiliaryFiles(outDir, staged, schemaDir, mode, cfg)
+}
+
+// Stage links the data files of sources, with their schemas, into a staging tree in outDir
+func Stage(sources []string, outDir string, mode LinkMode, policy CollisionPolicy, cfg Config) {
+
+	if len(sources) == 0 {
+		log.Fatal().Msg("Error: no source directory")
+	}
+	if _, err := os.Stat(outDir); err == nil {
+		log.Fatal().Str("Path", outDir).Msg("Error: output directory already exists")
+	}
+	idxDir := cfg.IdxDir
+	cfg.IdxDir = ""
+	var sourceTables []TableMap
+	for _, source := range sources {
+		if isArchive(source) {
+			log.Fatal().Str("Path", source).Msg("Error: archives are not supported, use extraction first")
+		}
+		log.Info().Str("Path", source).Msg("Analyze source directory")
+		sourceTables = append(sourceTables, scan(source, cfg))
+	}
+	staged, files, err := stageTables(sources, sourceTables, policy)
+	if err != nil {
+		log.Fatal().AnErr("Collision", err).Msg("Error while staging data entries")
+	}
+	err = addIndexes(staged, idxDir)
+	if err != nil {
+		log.Fatal().AnErr("WalkDir", err).Msg("Error while scanning path")
+	}
+	cfg.IdxDir = idxDir
+
+	schemaDir := cfg.SchemaDir
+	if schemaDir == "" {
+		schemaDir = sources[0]
+	}
+	log.Info().Str("Path", outDir).Str("Link", string(mode)).Int("Files", len(files)).Msg("Write staging tree")
+	err = writeStage(outDir, staged, files, schemaDir, mode, cfg)
+	if err != nil {
+		log.Fatal().AnErr("Stage", err).Msg("Error while writing staging tree")
+	}
+}
@@ -0,0 +1,76 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStageTables check data entries of several sources are merged and collisions renamed
+func TestStageTables(t *testing.T) {
+	sources := []string{t.TempDir(), t.TempDir()}
+	inputDir := sources[1]
+	addTestFiles(t, inputDir, nil, map[string]string{
+		"run2/Object_chunk_2.txt": "1\n",
+		"run2/Object_chunk_1.txt": "1\n",
+		"Filter/Filter.csv":       "1\n",
+	})
+	sourceTables := []TableMap{
+		writeTestTree(t, sources[0]),
+		walkDirs(inputDir, Config{PathTemplate: "{run}/{table}_{file}", UnknownFiles: PolicyIgnore}),
+	}
+	assert.Len(t, sourceTables[1], 1, "Filter.csv should not match the template")
+	sourceTables[1]["Filter"] = walkDirs(inputDir, Config{Include: []string{"Filter"}})["Filter"]
+
+	staged, files, err := stageTables(sources, sourceTables, CollisionRename)
+	assert.NoError(t, err)
+	expected := []stagedFile{
+		{src: filepath.Join(sources[0], "Filter/Filter.csv"), rpath: "Filter/Filter.csv"},
+		{src: filepath.Join(sources[0], "Object/DIR1/chunk_1.txt"), rpath: "Object/DIR1/chunk_1.txt"},
+		{src: filepath.Join(sources[0], "Object/DIR1/chunk_1_overlap.txt"), rpath: "Object/DIR1/chunk_1_overlap.txt"},
+		{src: filepath.Join(sources[1], "Filter/Filter.csv"), rpath: "Filter/Filter_2/Filter.csv"},
+		{src: filepath.Join(sources[1], "run2/Object_chunk_1.txt"), rpath: "Object/run2/chunk_1.txt"},
+		{src: filepath.Join(sources[1], "run2/Object_chunk_2.txt"), rpath: "Object/run2/chunk_2.txt"},
+	}
+	assert.Equal(t, expected, files)
+	assert.Equal(t, data{Directory: "Object/run2/", Identifiers: map[string]string{"run": "run2"}, Chunks: []int{1, 2}}, staged["Object"].DataMap["Object/run2/"])
+
+	_, _, err = stageTables(sources, sourceTables, CollisionFail)
+	assert.Error(t, err)
+}
+
+// TestStage check the staging tree links source files and matches its metadata
+func TestStage(t *testing.T) {
+	sources := []string{t.TempDir(), t.TempDir()}
+	writeTestTree(t, sources[0])
+	writeTestTree(t, sources[1])
+	outDir := filepath.Join(t.TempDir(), "staging")
+	Stage(sources, outDir, LinkSymbolic, CollisionRename, Config{})
+
+	target, err := os.Readlink(filepath.Join(outDir, "Object", "DIR1_2", "chunk_1.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(sources[1], "Object", "DIR1", "chunk_1.txt"), target)
+
+	m, err := loadMetadata(filepath.Join(outDir, "metadata.json"))
+	assert.NoError(t, err)
+	expected := convert(walkDirs(outDir, Config{UnknownFiles: PolicyIgnore}), nil)
+	sortMetadata(&expected)
+	sortMetadata(m)
+	assert.Equal(t, expected, *m)
+}
+
+// TestWriteStageError check a partial staging tree is removed
+func TestWriteStageError(t *testing.T) {
+	sourceDir := t.TempDir()
+	staged := writeTestTree(t, sourceDir)
+	files := []stagedFile{
+		{src: filepath.Join(sourceDir, "Filter/Filter.csv"), rpath: "Filter/Filter.csv"},
+		{src: filepath.Join(sourceDir, "Object/DIR1/chunk_2.txt"), rpath: "Object/DIR1/chunk_2.txt"},
+	}
+	outDir := filepath.Join(t.TempDir(), "staging")
+	err := writeStage(outDir, staged, files, sourceDir, LinkSymbolic, Config{})
+	assert.ErrorContains(t, err, "chunk_2.txt")
+	assert.NoDirExists(t, outDir)
+}
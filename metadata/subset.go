@@ -0,0 +1,354 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Extract a subset of the chunks of a dataset into a new tree, to build small test datasets
+
+package metadata
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fjammes/qserv-tools/v2/partition"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+)
+
+// Name of the directory of index configuration files in a subset or staging tree
+const subsetIdxDir = "idx"
+
+// ChunkSelection selects the chunks of a subset, all criteria being combined
+type ChunkSelection struct {
+	// Chunk ids, all chunks if empty
+	Chunks []int
+	// Sky box intersecting the selected chunks, no constraint if nil
+	Box *partition.Box
+	// Tracts of the data entries whose chunks are selected, see Config.ProvenancePatterns
+	Tracts []string
+	// Number of chunks randomly selected among the matching ones, all of them if 0
+	Sample int
+	// Seed of the random sample
+	Seed int64
+	// Way files are added to the subset, copied if empty
+	Link LinkMode
+}
+
+// ParseChunkIds parses a comma separated list of chunk ids
+func ParseChunkIds(s string) ([]int, error) {
+	var chunks []int
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		chunkId, err := strconv.Atoi(f)
+		if err != nil || chunkId < 0 {
+			return nil, fmt.Errorf("invalid chunk id %q", f)
+		}
+		chunks = append(chunks, chunkId)
+	}
+	return chunks, nil
+}
+
+// allChunks returns the sorted ids of the chunks of tables
+func allChunks(tables TableMap) []int {
+	set := make(map[int]bool)
+	for _, spec := range tables {
+		for _, d := range spec.DataMap {
+			for _, chunkId := range d.Chunks {
+				set[chunkId] = true
+			}
+		}
+	}
+	chunks := make([]int, 0, len(set))
+	for chunkId := range set {
+		chunks = append(chunks, chunkId)
+	}
+	sort.Ints(chunks)
+	return chunks
+}
+
+// tractChunks returns the chunks of the data entries of tables whose tract is in tracts
+func tractChunks(tables TableMap, tracts []string, cfg Config) (map[int]bool, error) {
+	patterns, err := compileProvenancePatterns(cfg.ProvenancePatterns)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make(map[int]bool)
+	for _, spec := range tables {
+		for _, d := range spec.DataMap {
+			if !slices.Contains(tracts, extractProvenance(d, patterns)[provenanceTract]) {
+				continue
+			}
+			for _, chunkId := range d.Chunks {
+				chunks[chunkId] = true
+			}
+		}
+	}
+	return chunks, nil
+}
+
+// selectChunks returns the sorted ids of the chunks matching sel, chunker being only required for a box
+func selectChunks(tables TableMap, sel ChunkSelection, chunker *partition.Chunker, cfg Config) ([]int, error) {
+	chunks := allChunks(tables)
+	keep := func(match func(chunkId int) bool) {
+		var kept []int
+		for _, chunkId := range chunks {
+			if match(chunkId) {
+				kept = append(kept, chunkId)
+			}
+		}
+		chunks = kept
+	}
+
+	if len(sel.Chunks) != 0 {
+		for _, chunkId := range sel.Chunks {
+			if _, found := slices.BinarySearch(chunks, chunkId); !found {
+				log.Warn().Int("Chunk", chunkId).Msg("Selected chunk not found in data")
+			}
+		}
+		keep(func(chunkId int) bool { return slices.Contains(sel.Chunks, chunkId) })
+	}
+	if sel.Box != nil {
+		if chunker == nil {
+			return nil, fmt.Errorf("partitioning parameters are required to select chunks in a box")
+		}
+		keep(func(chunkId int) bool {
+			b, err := chunker.ChunkBox(chunkId)
+			if err != nil {
+				log.Warn().Err(err).Msg("Chunk ignored for box selection")
+				return false
+			}
+			return b.Intersects(*sel.Box)
+		})
+	}
+	if len(sel.Tracts) != 0 {
+		inTracts, err := tractChunks(tables, sel.Tracts, cfg)
+		if err != nil {
+			return nil, err
+		}
+		keep(func(chunkId int) bool { return inTracts[chunkId] })
+	}
+	if sel.Sample > 0 && sel.Sample < len(chunks) {
+		r := rand.New(rand.NewSource(sel.Seed))
+		r.Shuffle(len(chunks), func(i, j int) { chunks[i], chunks[j] = chunks[j], chunks[i] })
+		chunks = chunks[:sel.Sample]
+		sort.Ints(chunks)
+	}
+	return chunks, nil
+}
+
+// filterChunks returns the ids of chunkIds which are in the sorted list chunks
+func filterChunks(chunkIds []int, chunks []int) []int {
+	var res []int
+	for _, chunkId := range chunkIds {
+		if _, found := slices.BinarySearch(chunks, chunkId); found {
+			res = append(res, chunkId)
+		}
+	}
+	return res
+}
+
+// subsetTables restricts partitioned tables to chunks, removing those without data left, regular tables being kept
+func subsetTables(tables TableMap, chunks []int) TableMap {
+	subset := make(TableMap)
+	for tableName, spec := range tables {
+		dataMap := make(map[string]data)
+		for key, d := range spec.DataMap {
+			partitioned := len(d.Chunks) != 0 || len(d.Overlaps) != 0
+			d.Chunks = filterChunks(d.Chunks, chunks)
+			d.Overlaps = filterChunks(d.Overlaps, chunks)
+			if partitioned && len(d.Chunks) == 0 && len(d.Overlaps) == 0 {
+				continue
+			}
+			dataMap[key] = d
+		}
+		if len(dataMap) == 0 {
+			log.Info().Str("Table", tableName).Msg("No data in selected chunks, table removed")
+			continue
+		}
+		subset[tableName] = DataSpec{Indexes: spec.Indexes, DataMap: dataMap}
+	}
+	return subset
+}
+
+// LinkMode is the way files are added to a new tree: copy, hard or symbolic link
+type LinkMode string
+
+const (
+	LinkCopy     LinkMode = "copy"
+	LinkHard     LinkMode = "hard"
+	LinkSymbolic LinkMode = "symlink"
+)
+
+// ParseLinkMode parses the way files are added to a new tree: copy, hard or symlink
+func ParseLinkMode(s string) (LinkMode, error) {
+	m := LinkMode(s)
+	switch m {
+	case LinkCopy, LinkHard, LinkSymbolic:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown link mode %q, use copy, hard or symlink", s)
+}
+
+// copyFile copies or links src to dst according to mode, symbolic links targeting the absolute path of src
+func copyFile(src string, dst string, mode LinkMode) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case LinkHard:
+		return os.Link(src, dst)
+	case LinkSymbolic:
+		target, err := filepath.Abs(src)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(target); err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeSubset copies the data files, schemas and index configuration files of tables into outDir
+func writeSubset(inputDir string, outDir string, tables TableMap, schemaDir string, mode LinkMode, cfg Config) error {
+	files := dataFiles(tables)
+	errs := make([]error, len(files))
+	parallel(len(files), workers(cfg), func(i int) {
+		rpath := filepath.FromSlash(files[i].rpath)
+		errs[i] = copyFile(filepath.Join(inputDir, rpath), filepath.Join(outDir, rpath), mode)
+	})
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("unable to copy data file %q: %v", files[i].rpath, err)
+		}
+	}
+	return copyAuxiliaryFiles(outDir, tables, schemaDir, mode, cfg)
+}
+
+// copyAuxiliaryFiles copies the database, table schema and index configuration files of tables into outDir
+func copyAuxiliaryFiles(outDir string, tables TableMap, schemaDir string, mode LinkMode, cfg Config) error {
+	var schemaFiles []string
+	if cfg.DbJsonFile != "" {
+		schemaFiles = append(schemaFiles, cfg.DbJsonFile)
+	}
+	for tableName, spec := range tables {
+		schemaFiles = append(schemaFiles, tableName+".json")
+		for _, idx := range spec.Indexes {
+			err := copyFile(filepath.Join(cfg.IdxDir, idx), filepath.Join(outDir, subsetIdxDir, idx), mode)
+			if err != nil {
+				return fmt.Errorf("unable to copy index file %q: %v", idx, err)
+			}
+		}
+	}
+	for _, f := range schemaFiles {
+		err := copyFile(filepath.Join(schemaDir, f), filepath.Join(outDir, f), mode)
+		if os.IsNotExist(err) {
+			log.Warn().Str("File", f).Str("Path", schemaDir).Msg("Schema file not found")
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to copy schema file %q: %v", f, err)
+		}
+	}
+	return nil
+}
+
+// Subset copies the chunks of inputDir selected by sel, with regular tables and schemas, into a new outDir
+func Subset(inputDir string, outDir string, sel ChunkSelection, cfg Config) {
+
+	if isArchive(inputDir) {
+		log.Fatal().Str("Path", inputDir).Msg("Error: archives are not supported, use extraction first")
+	}
+	if _, err := os.Stat(outDir); err == nil {
+		log.Fatal().Str("Path", outDir).Msg("Error: output directory already exists")
+	}
+	schemaDir := cfg.SchemaDir
+	if schemaDir == "" {
+		schemaDir = inputDir
+	}
+	var chunker *partition.Chunker
+	if sel.Box != nil {
+		var err error
+		chunker, err = loadChunker(filepath.Join(schemaDir, cfg.DbJsonFile))
+		if err != nil {
+			log.Fatal().AnErr("Partitioning", err).Msg("Error while loading partitioning parameters")
+		}
+	}
+
+	log.Info().Str("Path", inputDir).Msg("Analyze data directory")
+	tables := scan(inputDir, cfg)
+	chunks, err := selectChunks(tables, sel, chunker, cfg)
+	if err != nil {
+		log.Fatal().AnErr("Selection", err).Msg("Error while selecting chunks")
+	}
+	if len(chunks) == 0 {
+		log.Fatal().Msg("Error: no chunk selected")
+	}
+	log.Info().Ints("Chunks", chunks).Msg("Selected chunks")
+	subset := subsetTables(tables, chunks)
+
+	log.Info().Str("Path", outDir).Str("Link", string(sel.Link)).Msg("Write subset")
+	err = writeSubset(inputDir, outDir, subset, schemaDir, sel.Link, cfg)
+	if err != nil {
+		os.RemoveAll(outDir)
+		log.Fatal().AnErr("Subset", err).Msg("Error while writing subset")
+	}
+
+	var orderedTables []string
+	for _, tableName := range cfg.OrderedTables {
+		if _, ok := subset[tableName]; ok {
+			orderedTables = append(orderedTables, tableName)
+		}
+	}
+	cfg.OrderedTables = orderedTables
+	outFile := filepath.Join(outDir, "metadata.json")
+	log.Info().Str("Path", outFile).Msg("Generate JSON file")
+	err = writeMetadata(subset, outFile, cfg)
+	if err != nil {
+		os.RemoveAll(outDir)
+		log.Fatal().AnErr("Metadata", err).Msg("Error while writing metadata file")
+	}
+}
@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fjammes/qserv-tools/v2/partition"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSelectChunks check chunks are selected by list, sky box and random sample
+func TestSelectChunks(t *testing.T) {
+	testDir := testDataDir()
+	tables := walkDirs(testDir, Config{})
+	chunker, err := loadChunker(filepath.Join(testDir, "database.json"))
+	assert.NoError(t, err)
+
+	chunks, err := selectChunks(tables, ChunkSelection{Chunks: []int{7648, 6630, 1}}, nil, Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{6630, 7648}, chunks)
+
+	box := partition.Box{LonMin: 0, LonMax: 1, LatMin: -5.5, LatMax: -5}
+	_, err = selectChunks(tables, ChunkSelection{Box: &box}, nil, Config{})
+	assert.Error(t, err, "Box selection requires partitioning parameters")
+	chunks, err = selectChunks(tables, ChunkSelection{Box: &box}, chunker, Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{6630, 6800}, chunks)
+
+	sel := ChunkSelection{Sample: 3, Seed: 42}
+	chunks, err = selectChunks(tables, sel, chunker, Config{})
+	assert.NoError(t, err)
+	assert.Len(t, chunks, 3)
+	again, err := selectChunks(tables, sel, chunker, Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, chunks, again, "Samples should only depend on the seed")
+}
+
+// TestWriteSubset check director and child tables are restricted to the same chunks
+func TestWriteSubset(t *testing.T) {
+	testDir := testDataDir()
+	cfg := Config{DbJsonFile: "database.json", IdxDir: filepath.Join(testDir, "idx")}
+	tables := walkDirs(testDir, cfg)
+	subset := subsetTables(tables, []int{6631, 7310})
+	assert.Equal(t, data{Directory: "Object/DIR1/", Chunks: []int{6631, 7310}, Overlaps: []int{6631}}, subset["Object"].DataMap["Object/DIR1/"])
+	assert.NotContains(t, subset["Object"].DataMap, "Object/DIR2/")
+	assert.Equal(t, []int{6631, 7310}, subset["Source"].DataMap["Source/DIR1/"].Chunks)
+	assert.Equal(t, tables["Filter"], subset["Filter"], "Regular tables should be kept")
+
+	outDir := t.TempDir()
+	assert.NoError(t, writeSubset(testDir, outDir, subset, testDir, LinkHard, cfg))
+	for _, rpath := range []string{
+		"Object/DIR1/chunk_6631.txt",
+		"Object/DIR1/chunk_6631_overlap.txt",
+		"Source/DIR1/chunk_7310.txt",
+		"Filter/Filter.tsv",
+		"Object.json",
+		"database.json",
+		"idx/idx_sdqa_Metric_id.json",
+	} {
+		_, err := os.Stat(filepath.Join(outDir, rpath))
+		assert.NoError(t, err, rpath)
+	}
+	_, err := os.Stat(filepath.Join(outDir, "Object/DIR1/chunk_6630.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, subset, walkDirs(outDir, Config{IdxDir: filepath.Join(outDir, subsetIdxDir)}), "Subset tree should match subset tables")
+}
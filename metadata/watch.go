@@ -0,0 +1,322 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Watch an input directory while partitioning jobs write it, keep its metadata up to date
+// and report data directories which are completed
+
+package metadata
+
+import (
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// Types of the events emitted by the watch mode
+const (
+	// metadata.json was rewritten
+	EventMetadataUpdated = "metadata_updated"
+	// No file of a data directory changed during the settle delay
+	EventDirectoryCompleted = "directory_completed"
+)
+
+// WatchEvent is emitted, as a JSON line, when metadata.json is rewritten or a data directory is completed
+type WatchEvent struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Table     string    `json:"table,omitempty"`
+	Directory string    `json:"directory,omitempty"`
+	Chunks    int       `json:"chunks,omitempty"`
+	Files     int       `json:"files,omitempty"`
+	Path      string    `json:"path,omitempty"`
+}
+
+// entryKey identifies a data entry of a table
+type entryKey struct {
+	table string
+	key   string
+}
+
+// watchState is the metadata of a watched directory, updated with file system events
+type watchState struct {
+	inputDir string
+	tpl      *pathTemplate
+	filter   *fileFilter
+	tables   TableMap
+	// Data files in tables, by path relative to inputDir
+	files map[string]fileLocation
+	// Time of the last change of the data entries which are not completed
+	activity map[entryKey]time.Time
+	// Tables changed since metadata.json was written
+	dirty  bool
+	events *json.Encoder
+}
+
+func newWatchState(inputDir string, cfg Config, events io.Writer) (*watchState, error) {
+	tpl, err := newPathTemplate(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &watchState{
+		inputDir: filepath.Join(inputDir),
+		tpl:      tpl,
+		filter:   newFileFilter(cfg),
+		tables:   make(TableMap),
+		files:    make(map[string]fileLocation),
+		activity: make(map[entryKey]time.Time),
+		events:   json.NewEncoder(events),
+	}, nil
+}
+
+func (w *watchState) rpath(path string) string {
+	return filepath.ToSlash(strings.TrimPrefix(strings.TrimPrefix(path, w.inputDir), string(filepath.Separator)))
+}
+
+// emit writes an event, failures being only logged as the metadata remains valid
+func (w *watchState) emit(e WatchEvent) {
+	log.Info().Str("Type", e.Type).Str("Table", e.Table).Str("Directory", e.Directory).Msg("Watch event")
+	if err := w.events.Encode(e); err != nil {
+		log.Error().Err(err).Msg("Unable to write watch event")
+	}
+}
+
+// addFile adds a new data file to tables, unknown and filtered files being ignored
+func (w *watchState) addFile(path string, now time.Time) {
+	rpath := w.rpath(path)
+	if _, ok := w.files[rpath]; ok {
+		return
+	}
+	loc, err := locate(rpath, w.tpl)
+	if err == nil {
+		var ok bool
+		ok, err = w.filter.accept(rpath, loc.ftype)
+		if !ok && err == nil {
+			return
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("File", rpath).Msg("File ignored")
+		return
+	}
+	if !isDataFile(loc.ftype) {
+		return
+	}
+	if err := appendLocation(w.tables, loc); err != nil {
+		log.Warn().Err(err).Str("File", rpath).Msg("File ignored")
+		return
+	}
+	log.Debug().Str("File", rpath).Msg("Data file added")
+	w.files[rpath] = loc
+	w.activity[entryKey{table: loc.table, key: loc.key}] = now
+	w.dirty = true
+}
+
+// removeFiles removes the data files whose path is path, or which are inside directory path
+func (w *watchState) removeFiles(path string, now time.Time) {
+	rpath := w.rpath(path)
+	for p, loc := range w.files {
+		if p != rpath && !strings.HasPrefix(p, rpath+"/") {
+			continue
+		}
+		log.Debug().Str("File", p).Msg("Data file removed")
+		removeDataFile(w.tables, dataFile{table: loc.table, key: loc.key, rpath: p, ftype: loc.ftype, chunkId: loc.chunkId})
+		delete(w.files, p)
+		d := w.tables[loc.table].DataMap[loc.key]
+		if len(d.Chunks) == 0 && len(d.Overlaps) == 0 && len(d.Files) == 0 {
+			delete(w.tables[loc.table].DataMap, loc.key)
+			delete(w.activity, entryKey{table: loc.table, key: loc.key})
+			if len(w.tables[loc.table].DataMap) == 0 {
+				delete(w.tables, loc.table)
+			}
+		} else {
+			w.activity[entryKey{table: loc.table, key: loc.key}] = now
+		}
+		w.dirty = true
+	}
+}
+
+// touch records a change of a data file which is already known, like a file still being written
+func (w *watchState) touch(path string, now time.Time) {
+	if loc, ok := w.files[w.rpath(path)]; ok {
+		w.activity[entryKey{table: loc.table, key: loc.key}] = now
+	}
+}
+
+// addTree adds the data files of a directory tree, watch being called on each directory before listing it
+func (w *watchState) addTree(root string, now time.Time, watch func(dir string)) error {
+	return filepath.WalkDir(root, func(path string, info fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			watch(path)
+		} else {
+			w.addFile(path, now)
+		}
+		return nil
+	})
+}
+
+// snapshot returns a copy of tables, so that writing metadata does not alter them
+func (w *watchState) snapshot() TableMap {
+	tables := make(TableMap)
+	for tableName, spec := range w.tables {
+		dataMap := make(map[string]data, len(spec.DataMap))
+		for key, d := range spec.DataMap {
+			d.Chunks = append([]int(nil), d.Chunks...)
+			d.Overlaps = append([]int(nil), d.Overlaps...)
+			d.Files = append([]string(nil), d.Files...)
+			sort.Ints(d.Chunks)
+			sort.Ints(d.Overlaps)
+			sort.Strings(d.Files)
+			dataMap[key] = d
+		}
+		tables[tableName] = DataSpec{Indexes: spec.Indexes, DataMap: dataMap}
+	}
+	return tables
+}
+
+// flush rewrites outFile if tables changed and are valid, then reports entries unchanged since settle as completed
+func (w *watchState) flush(outFile string, settle time.Duration, now time.Time, cfg Config) error {
+	if w.dirty {
+		tables := w.snapshot()
+		// An index file may be written before the first data file of its table
+		if err := addIndexes(tables, cfg.IdxDir); err != nil {
+			return err
+		}
+		cfg.OrderedTables = nil
+		cfg.report = newReport(cfg.Strict)
+		if err := writeMetadata(tables, outFile, cfg); err != nil {
+			return err
+		}
+		w.dirty = false
+		w.emit(WatchEvent{Type: EventMetadataUpdated, Time: now, Path: outFile})
+	}
+	var completed []entryKey
+	for k, t := range w.activity {
+		if now.Sub(t) >= settle {
+			completed = append(completed, k)
+		}
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		if completed[i].table != completed[j].table {
+			return completed[i].table < completed[j].table
+		}
+		return completed[i].key < completed[j].key
+	})
+	for _, k := range completed {
+		delete(w.activity, k)
+		d := w.tables[k.table].DataMap[k.key]
+		w.emit(WatchEvent{
+			Type:      EventDirectoryCompleted,
+			Time:      now,
+			Table:     k.table,
+			Directory: k.key,
+			Chunks:    len(d.Chunks),
+			Files:     len(d.Files),
+		})
+	}
+	return nil
+}
+
+// Watch updates outFile every interval while data files are added to or removed from inputDir, and writes events
+func Watch(inputDir string, outFile string, eventsFile string, interval time.Duration, settle time.Duration, cfg Config) {
+
+	requireInputDir(inputDir)
+	events := io.Writer(os.Stdout)
+	if eventsFile != "" {
+		f, err := os.OpenFile(eventsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error while opening events file")
+		}
+		defer f.Close()
+		events = f
+	}
+	w, err := newWatchState(inputDir, cfg, events)
+	if err != nil {
+		log.Fatal().AnErr("Template", err).Msg("Error in configuration")
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error while creating watcher")
+	}
+	defer watcher.Close()
+
+	watch := func(dir string) {
+		if err := watcher.Add(dir); err != nil {
+			log.Error().Err(err).Str("Path", dir).Msg("Error while watching directory")
+		}
+	}
+	addTree := func(root string) {
+		err := w.addTree(root, time.Now(), watch)
+		if err != nil && !os.IsNotExist(err) {
+			log.Error().Err(err).Str("Path", root).Msg("Error while scanning directory")
+		}
+	}
+	log.Info().Str("Path", inputDir).Dur("Interval", interval).Dur("Settle", settle).Msg("Watch data directory")
+	addTree(w.inputDir)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			now := time.Now()
+			switch {
+			case event.Has(fsnotify.Create):
+				info, err := os.Lstat(event.Name)
+				if err != nil {
+					continue
+				}
+				if info.IsDir() {
+					addTree(event.Name)
+				} else {
+					w.addFile(event.Name, now)
+				}
+			case event.Has(fsnotify.Write):
+				w.touch(event.Name, now)
+			case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+				w.removeFiles(event.Name, now)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Error().Err(err).Msg("Watcher error")
+		case now := <-ticker.C:
+			if err := w.flush(outFile, settle, now, cfg); err != nil {
+				log.Error().Err(err).Str("Path", outFile).Msg("Error while writing metadata file")
+			}
+		}
+	}
+}
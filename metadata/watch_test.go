@@ -0,0 +1,105 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readEvents(t *testing.T, buf *bytes.Buffer) []string {
+	var types []string
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var e WatchEvent
+		assert.NoError(t, dec.Decode(&e))
+		types = append(types, e.Type+" "+e.Directory)
+	}
+	return types
+}
+
+// TestWatchState check metadata follows added and removed files, and directories complete after the settle delay
+func TestWatchState(t *testing.T) {
+	inputDir := t.TempDir()
+	writeTestTree(t, inputDir)
+	outFile := filepath.Join(t.TempDir(), "metadata.json")
+	var events bytes.Buffer
+	w, err := newWatchState(inputDir, Config{}, &events)
+	assert.NoError(t, err)
+	var watched []string
+	t0 := time.Now()
+	assert.NoError(t, w.addTree(inputDir, t0, func(dir string) { watched = append(watched, w.rpath(dir)) }))
+	assert.Equal(t, []string{"", "Filter", "Object", "Object/DIR1"}, watched)
+
+	settle := time.Minute
+	cfg := Config{DbJsonFile: "database.json"}
+	assert.NoError(t, w.flush(outFile, settle, t0.Add(10*time.Second), cfg))
+	assert.Equal(t, []string{"metadata_updated "}, readEvents(t, &events))
+	m, err := loadMetadata(outFile)
+	assert.NoError(t, err)
+	sortMetadata(m)
+	assert.Equal(t, []int{1}, m.Tables[1].Data[0].Chunks)
+	assert.Nil(t, m.Tables[1].Data[0].Overlaps)
+
+	assert.NoError(t, w.flush(outFile, settle, t0.Add(2*time.Minute), cfg))
+	assert.Equal(t, []string{"directory_completed Filter/", "directory_completed Object/DIR1/"}, readEvents(t, &events))
+
+	t1 := t0.Add(3 * time.Minute)
+	path := filepath.Join(inputDir, "Object", "DIR1", "chunk_2.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("3\n"), 0644))
+	w.addFile(path, t1)
+	w.addFile(path, t1)
+	assert.NoError(t, w.flush(outFile, settle, t1, cfg))
+	m, err = loadMetadata(outFile)
+	assert.NoError(t, err)
+	sortMetadata(m)
+	assert.Equal(t, data{Directory: "Object/DIR1/", Chunks: []int{1, 2}, Overlaps: []int{1}}, m.Tables[1].Data[0], "Writing metadata should not alter overlaps")
+
+	w.removeFiles(filepath.Join(inputDir, "Object"), t1)
+	assert.NotContains(t, w.tables, "Object")
+	assert.NoError(t, w.flush(outFile, settle, t1.Add(2*time.Minute), cfg))
+	assert.Equal(t, []string{"metadata_updated ", "metadata_updated "}, readEvents(t, &events), "Removed directories should not be completed")
+	m, err = loadMetadata(outFile)
+	assert.NoError(t, err)
+	assert.Len(t, m.Tables, 1)
+
+	path = filepath.Join(inputDir, "Filter", "chunk_1.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("3\n"), 0644))
+	w.addFile(path, t1)
+	assert.Error(t, w.flush(outFile, settle, t1, cfg), "Table with chunks and regular files should not be written")
+	assert.Empty(t, readEvents(t, &events))
+	m, err = loadMetadata(outFile)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Filter.csv"}, m.Tables[0].Data[0].Files)
+}
+
+// TestWatchIndexBeforeData check an index file of a table without data delays the metadata update
+func TestWatchIndexBeforeData(t *testing.T) {
+	inputDir := t.TempDir()
+	idxDir := t.TempDir()
+	addTestFiles(t, inputDir, nil, map[string]string{"Filter/Filter.csv": "0,u\n"})
+	addTestFiles(t, idxDir, nil, map[string]string{"idx_Object_objectId.json": "{}\n"})
+	outFile := filepath.Join(t.TempDir(), "metadata.json")
+	var events bytes.Buffer
+	cfg := Config{IdxDir: idxDir}
+	w, err := newWatchState(inputDir, cfg, &events)
+	assert.NoError(t, err)
+	t0 := time.Now()
+	assert.NoError(t, w.addTree(inputDir, t0, func(string) {}))
+	assert.Error(t, w.flush(outFile, time.Minute, t0, cfg))
+	assert.True(t, w.dirty)
+	assert.NoFileExists(t, outFile)
+
+	path := filepath.Join(inputDir, "Object", "DIR1", "chunk_1.txt")
+	addTestFiles(t, inputDir, nil, map[string]string{"Object/DIR1/chunk_1.txt": "1\n"})
+	w.addFile(path, t0)
+	assert.NoError(t, w.flush(outFile, time.Minute, t0, cfg))
+	m, err := loadMetadata(outFile)
+	assert.NoError(t, err)
+	sortMetadata(m)
+	assert.Equal(t, []string{"idx_Object_objectId.json"}, m.Tables[1].Indexes)
+}
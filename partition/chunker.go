@@ -0,0 +1,270 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Qserv spherical partitioning, as implemented by the Chunker class of lsst/sphgeom
+// (see sphgeom/src/Chunker.cc), the overlap extent being computed as in the
+// Qserv partitioner (see qserv/src/partition/Geometry.cc)
+
+package partition
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Distance to the poles, in degrees, below which an overlap circle contains a pole
+const epsilonDeg = 1.0 / 3600.0
+
+// Chunker maps sky positions to Qserv chunks
+type Chunker struct {
+	overlap                float64
+	numStripes             int
+	numSubStripesPerStripe int
+	subStripeHeight        float64
+	numChunksPerStripe     []int
+	numSubChunksPerChunk   []int
+	subChunkWidth          []float64
+	maxSubChunksPerChunk   int
+}
+
+// Box is a sky box in degrees, wrapping around 0 if LonMin is greater than LonMax
+type Box struct {
+	LonMin, LonMax float64
+	LatMin, LatMax float64
+}
+
+// clampLat returns a latitude clamped to [-90, 90]
+func clampLat(lat float64) float64 {
+	return math.Max(-90.0, math.Min(90.0, lat))
+}
+
+// maxAlpha returns the longitude extent of a circle of radius r centered at latitude centerLat
+func maxAlpha(r float64, centerLat float64) float64 {
+	if r == 0.0 {
+		return 0.0
+	}
+	lat := clampLat(centerLat)
+	if math.Abs(lat)+r > 90.0-epsilonDeg {
+		return 180.0
+	}
+	rRad := r * math.Pi / 180.0
+	latRad := lat * math.Pi / 180.0
+	y := math.Sin(rRad)
+	x := math.Sqrt(math.Abs(math.Cos(latRad-rRad) * math.Cos(latRad+rRad)))
+	return math.Abs(math.Atan(y/x)) * 180.0 / math.Pi
+}
+
+// segments returns the number of longitude segments of width at least width in [latMin, latMax]
+func segments(latMin float64, latMax float64, width float64) int {
+	if width > 180.0 {
+		return 1
+	}
+	lat := math.Max(math.Abs(latMin), math.Abs(latMax)) * math.Pi / 180.0
+	if lat > 0.5*math.Pi-4.85e-6 {
+		return 1
+	}
+	w := width * math.Pi / 180.0
+	sinLat := math.Sin(lat)
+	cosLat := math.Cos(lat)
+	x := math.Cos(w) - sinLat*sinLat
+	u := cosLat * cosLat
+	y := math.Sqrt(math.Abs(u*u - x*x))
+	return int(math.Floor(2.0 * math.Pi / math.Abs(math.Atan2(y, x))))
+}
+
+// NewChunker returns a chunker for the partitioning parameters of a database.json file
+func NewChunker(overlap float64, numStripes int, numSubStripesPerStripe int) (*Chunker, error) {
+	if numStripes < 1 || numSubStripesPerStripe < 1 {
+		return nil, fmt.Errorf("number of stripes and sub-stripes per stripe must be positive")
+	}
+	if overlap < 0.0 || overlap > 10.0 {
+		return nil, fmt.Errorf("overlap must be in range [0, 10] degrees")
+	}
+	numSubStripes := numStripes * numSubStripesPerStripe
+	stripeHeight := 180.0 / float64(numStripes)
+	c := Chunker{
+		overlap:                overlap,
+		numStripes:             numStripes,
+		numSubStripesPerStripe: numSubStripesPerStripe,
+		subStripeHeight:        180.0 / float64(numSubStripes),
+		numChunksPerStripe:     make([]int, numStripes),
+		numSubChunksPerChunk:   make([]int, numSubStripes),
+		subChunkWidth:          make([]float64, numSubStripes),
+	}
+	if c.subStripeHeight < overlap {
+		return nil, fmt.Errorf("overlap must not exceed sub-stripe height")
+	}
+	for i := 0; i < numStripes; i++ {
+		nc := segments(float64(i)*stripeHeight-90.0, float64(i+1)*stripeHeight-90.0, stripeHeight)
+		c.numChunksPerStripe[i] = nc
+		for j := 0; j < numSubStripesPerStripe; j++ {
+			ss := i*numSubStripesPerStripe + j
+			latMin := float64(ss)*c.subStripeHeight - 90.0
+			latMax := float64(ss+1)*c.subStripeHeight - 90.0
+			nsc := segments(latMin, latMax, c.subStripeHeight) / nc
+			if nsc > c.maxSubChunksPerChunk {
+				c.maxSubChunksPerChunk = nsc
+			}
+			c.numSubChunksPerChunk[ss] = nsc
+			c.subChunkWidth[ss] = 360.0 / float64(nsc*nc)
+		}
+	}
+	return &c, nil
+}
+
+// Locate returns the chunk and sub-chunk containing a position, in degrees
+func (c *Chunker) Locate(lon float64, lat float64) (chunkId int, subChunkId int) {
+	numSubStripes := c.numStripes * c.numSubStripesPerStripe
+	subStripe := int(math.Floor((lat + 90.0) / c.subStripeHeight))
+	if subStripe >= numSubStripes {
+		subStripe = numSubStripes - 1
+	} else if subStripe < 0 {
+		subStripe = 0
+	}
+	stripe := subStripe / c.numSubStripesPerStripe
+	lon = math.Mod(lon, 360.0)
+	if lon < 0 {
+		lon += 360.0
+	}
+	subChunk := int(math.Floor(lon / c.subChunkWidth[subStripe]))
+	numChunks := c.numChunksPerStripe[stripe]
+	numSubChunksPerChunk := c.numSubChunksPerChunk[subStripe]
+	if subChunk >= numChunks*numSubChunksPerChunk {
+		subChunk = numChunks*numSubChunksPerChunk - 1
+	}
+	chunk := subChunk / numSubChunksPerChunk
+	chunkId = stripe*2*c.numStripes + chunk
+	y := subStripe - stripe*c.numSubStripesPerStripe
+	x := subChunk - chunk*numSubChunksPerChunk
+	subChunkId = y*c.maxSubChunksPerChunk + x
+	return chunkId, subChunkId
+}
+
+// stripeChunk returns the stripe and chunk indexes of a chunk id
+func (c *Chunker) stripeChunk(chunkId int) (int, int, error) {
+	stripe := chunkId / (2 * c.numStripes)
+	chunk := chunkId % (2 * c.numStripes)
+	if chunkId < 0 || stripe >= c.numStripes || chunk >= c.numChunksPerStripe[stripe] {
+		return 0, 0, fmt.Errorf("invalid chunk id %d", chunkId)
+	}
+	return stripe, chunk, nil
+}
+
+// ChunkBox returns the bounds of a chunk
+func (c *Chunker) ChunkBox(chunkId int) (Box, error) {
+	stripe, chunk, err := c.stripeChunk(chunkId)
+	if err != nil {
+		return Box{}, err
+	}
+	stripeHeight := 180.0 / float64(c.numStripes)
+	width := 360.0 / float64(c.numChunksPerStripe[stripe])
+	return Box{
+		LonMin: float64(chunk) * width,
+		LonMax: float64(chunk+1) * width,
+		LatMin: float64(stripe)*stripeHeight - 90.0,
+		LatMax: float64(stripe+1)*stripeHeight - 90.0,
+	}, nil
+}
+
+// OverlapBox returns the bounds of a chunk extended by the overlap distance
+func (c *Chunker) OverlapBox(chunkId int) (Box, error) {
+	b, err := c.ChunkBox(chunkId)
+	if err != nil {
+		return Box{}, err
+	}
+	alpha := maxAlpha(c.overlap, math.Max(math.Abs(b.LatMin), math.Abs(b.LatMax)))
+	box := Box{
+		LatMin: clampLat(b.LatMin - c.overlap),
+		LatMax: clampLat(b.LatMax + c.overlap),
+	}
+	if alpha >= 180.0 || b.LonMax-b.LonMin+2*alpha >= 360.0 {
+		box.LonMin, box.LonMax = 0.0, 360.0
+	} else {
+		box.LonMin = math.Mod(b.LonMin-alpha+360.0, 360.0)
+		box.LonMax = math.Mod(b.LonMax+alpha, 360.0)
+	}
+	return box, nil
+}
+
+// Contains returns true if the position is inside the box extended by tolerance degrees
+func (b Box) Contains(lon float64, lat float64, tolerance float64) bool {
+	if lat < b.LatMin-tolerance || lat > b.LatMax+tolerance {
+		return false
+	}
+	if b.LonMin == 0.0 && b.LonMax == 360.0 {
+		return true
+	}
+	lon = math.Mod(lon, 360.0)
+	if lon < 0 {
+		lon += 360.0
+	}
+	if b.LonMin <= b.LonMax {
+		return lon >= b.LonMin-tolerance && lon <= b.LonMax+tolerance
+	}
+	return lon >= b.LonMin-tolerance || lon <= b.LonMax+tolerance
+}
+
+// lonIntervals returns the longitude intervals of the box, which are split in two if they wrap around 0
+func (b Box) lonIntervals() [][2]float64 {
+	if b.LonMin <= b.LonMax {
+		return [][2]float64{{b.LonMin, b.LonMax}}
+	}
+	return [][2]float64{{b.LonMin, 360.0}, {0.0, b.LonMax}}
+}
+
+// Intersects returns true if the boxes overlap
+func (b Box) Intersects(o Box) bool {
+	if b.LatMax < o.LatMin || o.LatMax < b.LatMin {
+		return false
+	}
+	for _, i := range b.lonIntervals() {
+		for _, j := range o.lonIntervals() {
+			if i[0] <= j[1] && j[0] <= i[1] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseBox parses a box given as "lonMin,lonMax,latMin,latMax", in degrees
+func ParseBox(s string) (Box, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 4 {
+		return Box{}, fmt.Errorf("invalid box %q, use lonMin,lonMax,latMin,latMax", s)
+	}
+	var values [4]float64
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return Box{}, fmt.Errorf("invalid box %q: %v", s, err)
+		}
+		values[i] = v
+	}
+	b := Box{LonMin: values[0], LonMax: values[1], LatMin: values[2], LatMax: values[3]}
+	if b.LonMin < 0 || b.LonMax > 360.0 || b.LatMin < -90.0 || b.LatMax > 90.0 || b.LatMin > b.LatMax {
+		return Box{}, fmt.Errorf("invalid box %q, longitudes must be in [0, 360] and latitudes in [-90, 90]", s)
+	}
+	return b, nil
+}
@@ -0,0 +1,63 @@
+package partition
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLocate check partition.Chunker.Locate() against positions partitioned for itest/case01
+func TestLocate(t *testing.T) {
+	c, err := NewChunker(0.01667, 85, 12)
+	assert.NoError(t, err)
+
+	positions := []struct {
+		lon, lat            float64
+		chunkId, subChunkId int
+	}{
+		{1.89083697951383, -6.05493264867207, 6630, 493},
+		{1.810030163801, -5.50527151254398, 6630, 700},
+		{0.973569140338083, -5.74735600024157, 6630, 626},
+	}
+	for _, p := range positions {
+		chunkId, subChunkId := c.Locate(p.lon, p.lat)
+		assert.Equal(t, p.chunkId, chunkId)
+		assert.Equal(t, p.subChunkId, subChunkId)
+	}
+}
+
+// TestOverlapBox check overlap boxes extend chunk boxes and wrap around longitude 0
+func TestOverlapBox(t *testing.T) {
+	c, err := NewChunker(0.01667, 85, 12)
+	assert.NoError(t, err)
+
+	chunk, err := c.ChunkBox(6630)
+	assert.NoError(t, err)
+	assert.True(t, chunk.Contains(1.89083697951383, -6.05493264867207, 0))
+	assert.False(t, chunk.Contains(2.81159201922812, -5.82518553123632, 0))
+
+	overlap, err := c.OverlapBox(6630)
+	assert.NoError(t, err)
+	assert.Greater(t, overlap.LonMin, overlap.LonMax, "Overlap of first chunk of a stripe should wrap around 0")
+	assert.True(t, overlap.Contains(359.995, chunk.LatMin, 0))
+	assert.True(t, overlap.Contains(chunk.LonMax+0.01, chunk.LatMax+0.01, 0))
+	assert.False(t, overlap.Contains(chunk.LonMax+0.1, chunk.LatMax, 0))
+
+	_, err = c.ChunkBox(6630 + 2*85 - 1)
+	assert.Error(t, err, "Chunk id beyond the number of chunks of the stripe")
+}
+
+// TestIntersects check box intersections, with boxes wrapping around longitude 0
+func TestIntersects(t *testing.T) {
+	b, err := ParseBox("350,10,-5,5")
+	assert.NoError(t, err)
+	assert.True(t, b.Intersects(Box{LonMin: 0, LonMax: 2, LatMin: 4, LatMax: 6}))
+	assert.True(t, b.Intersects(Box{LonMin: 355, LonMax: 356, LatMin: 0, LatMax: 1}))
+	assert.False(t, b.Intersects(Box{LonMin: 20, LonMax: 30, LatMin: 0, LatMax: 1}))
+	assert.False(t, b.Intersects(Box{LonMin: 0, LonMax: 2, LatMin: 6, LatMax: 7}))
+
+	_, err = ParseBox("0,10,5")
+	assert.Error(t, err)
+	_, err = ParseBox("0,10,5,-5")
+	assert.Error(t, err)
+}
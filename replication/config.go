@@ -0,0 +1,333 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Client model of the replication controller configuration, returned by its /replication/config service
+
+package replication
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Response is the document returned by /replication/config
+type Response struct {
+	Success *Flag  `json:"success,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Config  Config `json:"config"`
+}
+
+// Config is the configuration of the replication controller
+type Config struct {
+	// Parameters of the controller and the workers, by category, their format depending on the Qserv release
+	General   map[string]map[string]json.RawMessage `json:"general,omitempty"`
+	Workers   []Worker                              `json:"workers"`
+	Families  []Family                              `json:"database_families"`
+	Databases []Database                            `json:"databases"`
+	// Truncated is set if the document was truncated, in which case it only contains its complete values
+	Truncated bool `json:"-"`
+	// Warnings lists the entries which could not be decoded and were skipped
+	Warnings []string `json:"-"`
+}
+
+// Family is a database family, which shares its partitioning parameters with its databases
+type Family struct {
+	Name                string  `json:"name"`
+	MinReplicationLevel int     `json:"min_replication_level"`
+	NumStripes          int     `json:"num_stripes"`
+	NumSubStripes       int     `json:"num_sub_stripes"`
+	Overlap             float64 `json:"overlap"`
+}
+
+// Database is a database registered in the replication controller
+type Database struct {
+	Database    string  `json:"database"`
+	Family      string  `json:"family_name"`
+	IsPublished Flag    `json:"is_published"`
+	CreateTime  int64   `json:"create_time,omitempty"`
+	PublishTime int64   `json:"publish_time,omitempty"`
+	Tables      []Table `json:"tables,omitempty"`
+}
+
+// Table is a table of a registered database
+type Table struct {
+	Name          string   `json:"name"`
+	IsPartitioned Flag     `json:"is_partitioned"`
+	IsDirector    Flag     `json:"is_director"`
+	DirectorTable string   `json:"director_table,omitempty"`
+	DirectorKey   string   `json:"director_key,omitempty"`
+	LatitudeKey   string   `json:"latitude_key,omitempty"`
+	LongitudeKey  string   `json:"longitude_key,omitempty"`
+	AngSep        float64  `json:"ang_sep"`
+	IsPublished   Flag     `json:"is_published"`
+	CreateTime    int64    `json:"create_time,omitempty"`
+	PublishTime   int64    `json:"publish_time,omitempty"`
+	Columns       []Column `json:"columns,omitempty"`
+}
+
+// Column is a column of a table, with its MySQL type
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Worker is a replication worker and the services it runs
+type Worker struct {
+	Name             string `json:"name"`
+	IsEnabled        Flag   `json:"is_enabled"`
+	IsReadOnly       Flag   `json:"is_read_only"`
+	SvcHost          Host   `json:"svc_host"`
+	SvcPort          int    `json:"svc_port,omitempty"`
+	FsHost           Host   `json:"fs_host"`
+	FsPort           int    `json:"fs_port,omitempty"`
+	DataDir          string `json:"data_dir,omitempty"`
+	LoaderHost       Host   `json:"loader_host"`
+	LoaderPort       int    `json:"loader_port,omitempty"`
+	LoaderTmpDir     string `json:"loader_tmp_dir,omitempty"`
+	ExporterHost     Host   `json:"exporter_host"`
+	ExporterPort     int    `json:"exporter_port,omitempty"`
+	ExporterTmpDir   string `json:"exporter_tmp_dir,omitempty"`
+	HttpLoaderHost   Host   `json:"http_loader_host"`
+	HttpLoaderPort   int    `json:"http_loader_port,omitempty"`
+	HttpLoaderTmpDir string `json:"http_loader_tmp_dir,omitempty"`
+}
+
+// Flag is a boolean written as 0/1, true/false or "0"/"1" depending on the Qserv release
+type Flag bool
+
+func (f *Flag) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*f = Flag(v)
+	case float64:
+		*f = v != 0
+	case string:
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid flag %s", b)
+		}
+		*f = Flag(parsed)
+	case nil:
+		*f = false
+	default:
+		return fmt.Errorf("invalid flag %s", b)
+	}
+	return nil
+}
+
+// MarshalJSON writes flags as 0/1, like the replication controller
+func (f Flag) MarshalJSON() ([]byte, error) {
+	if f {
+		return []byte("1"), nil
+	}
+	return []byte("0"), nil
+}
+
+// Host is the host of a worker service, written as a name or as an address and a name depending on the Qserv release
+type Host struct {
+	Addr string `json:"addr,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+func (h *Host) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*h = Host{Name: name}
+		return nil
+	}
+	type host Host
+	return json.Unmarshal(b, (*host)(h))
+}
+
+// String returns the name of the host, or its address
+func (h Host) String() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return h.Addr
+}
+
+// rawResponse is decoded before the entries of the configuration, so that an invalid entry
+// does not prevent reading the others
+type rawResponse struct {
+	Success *Flag  `json:"success"`
+	Error   string `json:"error"`
+	Config  struct {
+		General   map[string]map[string]json.RawMessage `json:"general"`
+		Workers   []json.RawMessage                     `json:"workers"`
+		Families  []json.RawMessage                     `json:"database_families"`
+		Databases []json.RawMessage                     `json:"databases"`
+	} `json:"config"`
+}
+
+// decodeEntries decodes each entry of a list, skipping with a warning those which can not be decoded
+func decodeEntries[T any](name string, entries []json.RawMessage, warnings *[]string) []T {
+	var decoded []T
+	for i, entry := range entries {
+		var v T
+		if err := json.Unmarshal(entry, &v); err != nil {
+			*warnings = append(*warnings, fmt.Sprintf("%s[%d]: %v", name, i, err))
+			continue
+		}
+		decoded = append(decoded, v)
+	}
+	return decoded
+}
+
+// Parse decodes a /replication/config response. Unknown fields are ignored, entries which can not
+// be decoded are skipped and a truncated or corrupted response is cut after its last complete value
+func Parse(content []byte) (*Config, error) {
+	content, truncated, err := complete(content)
+	if err != nil {
+		return nil, err
+	}
+	var raw rawResponse
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	if raw.Success != nil && !*raw.Success {
+		return nil, fmt.Errorf("replication controller error: %q", raw.Error)
+	}
+	cfg := &Config{General: raw.Config.General, Truncated: truncated}
+	cfg.Workers = decodeEntries[Worker]("workers", raw.Config.Workers, &cfg.Warnings)
+	cfg.Families = decodeEntries[Family]("database_families", raw.Config.Families, &cfg.Warnings)
+	cfg.Databases = decodeEntries[Database]("databases", raw.Config.Databases, &cfg.Warnings)
+	return cfg, nil
+}
+
+// ReadFile decodes a /replication/config response saved in a file
+func ReadFile(filename string) (*Config, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("in file %q: %v", filename, err)
+	}
+	return cfg, nil
+}
+
+// Family returns the database family named name
+func (c *Config) Family(name string) (*Family, bool) {
+	for i := range c.Families {
+		if c.Families[i].Name == name {
+			return &c.Families[i], true
+		}
+	}
+	return nil, false
+}
+
+// Database returns the database named name
+func (c *Config) Database(name string) (*Database, bool) {
+	for i := range c.Databases {
+		if c.Databases[i].Database == name {
+			return &c.Databases[i], true
+		}
+	}
+	return nil, false
+}
+
+// complete returns a valid JSON document, made of the complete values of content if it is truncated
+// or corrupted, like responses read from a pod whose output was split. Bytes following a complete
+// document are ignored. Otherwise the document is cut before the first syntax error, then at the last
+// position where all its containers can be closed, array elements which are not complete being dropped
+func complete(content []byte) ([]byte, bool, error) {
+	var v json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(content))
+	if err := dec.Decode(&v); err == nil {
+		return content[:dec.InputOffset()], false, nil
+	}
+	err := json.Unmarshal(content, &v)
+	if syntaxErr, ok := err.(*json.SyntaxError); ok && syntaxErr.Offset < int64(len(content)) {
+		content = content[:syntaxErr.Offset-1]
+	}
+	var stack, safeStack []byte
+	safe := -1
+	// Depth of the outermost array element which is an open container, -1 if there is none
+	element := -1
+	inString, escaped := false, false
+	for i, c := range content {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+			continue
+		case '{', '[':
+			// An incomplete container of an array is dropped rather than closed partially
+			if element < 0 && len(stack) != 0 && stack[len(stack)-1] == '[' {
+				element = len(stack)
+			}
+			stack = append(stack, c)
+		case '}', ']':
+			if len(stack) == 0 {
+				return nil, false, fmt.Errorf("invalid JSON document: unexpected %q at offset %d", c, i)
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == element {
+				element = -1
+			}
+		case ',':
+			if element < 0 {
+				safe, safeStack = i, append(safeStack[:0], stack...)
+			}
+			continue
+		default:
+			continue
+		}
+		if element < 0 {
+			safe, safeStack = i+1, append(safeStack[:0], stack...)
+		}
+	}
+	if safe < 0 || len(stack) == 0 {
+		return nil, false, fmt.Errorf("invalid JSON document")
+	}
+	closed := append([]byte{}, content[:safe]...)
+	for i := len(safeStack) - 1; i >= 0; i-- {
+		if safeStack[i] == '{' {
+			closed = append(closed, '}')
+		} else {
+			closed = append(closed, ']')
+		}
+	}
+	if !json.Valid(closed) {
+		return nil, false, fmt.Errorf("invalid JSON document")
+	}
+	return closed, true, nil
+}
@@ -0,0 +1,111 @@
+package replication
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func srcDir() string {
+	_, filename, _, _ := runtime.Caller(0)
+	return filepath.Dir(filepath.Dir(filename))
+}
+
+// TestReadFile check the response of a replication controller, truncated after 8192 bytes
+// and corrupted after 4095 bytes, is decoded
+func TestReadFile(t *testing.T) {
+	cfg, err := ReadFile(filepath.Join(srcDir(), "cmd", "ingest", "response.json"))
+	assert.NoError(t, err)
+	assert.True(t, cfg.Truncated)
+	assert.Empty(t, cfg.Warnings)
+	assert.Equal(t, []Family{
+		{Name: "layout_340_3", MinReplicationLevel: 1, NumStripes: 340, NumSubStripes: 3, Overlap: 0.01667},
+		{Name: "layout_85_12", MinReplicationLevel: 1, NumStripes: 85, NumSubStripes: 12, Overlap: 0.01667},
+	}, cfg.Families)
+	family, ok := cfg.Family("layout_85_12")
+	assert.True(t, ok)
+	assert.Equal(t, 85, family.NumStripes)
+
+	// The only database is truncated in its table columns
+	assert.Empty(t, cfg.Databases)
+	_, ok = cfg.Database("dc2_run2_1i_dr1b")
+	assert.False(t, ok)
+}
+
+func TestParse(t *testing.T) {
+	response := `{"success": 1, "error": "", "config": {
+		"general": {"controller": {"num_threads": 16}},
+		"workers": [
+			{"name": "worker-0", "is_enabled": true, "is_read_only": "0", "svc_host": "qserv-worker-0", "svc_port": 25000},
+			{"name": "worker-1", "is_enabled": 1, "svc_host": {"addr": "10.0.0.1", "name": "qserv-worker-1"}, "unknown": []},
+			{"name": "worker-2", "svc_port": "25000"}
+		],
+		"database_families": [],
+		"databases": [{"database": "db", "family_name": "f", "is_published": 0, "tables": [
+			{"name": "Object", "is_partitioned": 1, "is_director": 1, "director_key": "objectId", "columns": []}
+		]}]
+	}}`
+	cfg, err := Parse([]byte(response))
+	assert.NoError(t, err)
+	assert.False(t, cfg.Truncated)
+	assert.Equal(t, []Worker{
+		{Name: "worker-0", IsEnabled: true, SvcHost: Host{Name: "qserv-worker-0"}, SvcPort: 25000},
+		{Name: "worker-1", IsEnabled: true, SvcHost: Host{Addr: "10.0.0.1", Name: "qserv-worker-1"}},
+	}, cfg.Workers)
+	assert.Len(t, cfg.Warnings, 1)
+	assert.Contains(t, cfg.Warnings[0], "workers[2]")
+	assert.Equal(t, "16", string(cfg.General["controller"]["num_threads"]))
+	assert.Equal(t, Table{Name: "Object", IsPartitioned: true, IsDirector: true, DirectorKey: "objectId", Columns: []Column{}}, cfg.Databases[0].Tables[0])
+
+	_, err = Parse([]byte(`{"success": 0, "error": "authorization failed", "config": {}}`))
+	assert.ErrorContains(t, err, "authorization failed")
+	_, err = Parse([]byte(`curl: (7) Failed to connect`))
+	assert.Error(t, err)
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{content: `{"a": [1, 2`, want: `{"a": [1]}`},
+		{content: `{"a": [1, 2]`, want: `{"a": [1, 2]}`},
+		{content: `{"a": {"b": "x,]"`, want: `{"a": {}}`},
+		{content: `{"a": [{"b": 1}, {"b": "\"`, want: `{"a": [{"b": 1}]}`},
+		{content: "{\"a\": [\"x\", \"y\nz\"], \"b\": 1}", want: `{"a": ["x"]}`},
+		{content: `{"a": [{"b": 1}, {"b": 2, "c": 3, "d"`, want: `{"a": [{"b": 1}]}`},
+		{content: `{"a": [[1, 2], [3, 4`, want: `{"a": [[1, 2]]}`},
+	}
+	for _, test := range tests {
+		got, truncated, err := complete([]byte(test.content))
+		assert.NoError(t, err, test.content)
+		assert.True(t, truncated, test.content)
+		assert.Equal(t, test.want, string(got), test.content)
+	}
+	_, _, err := complete([]byte(`"abc`))
+	assert.Error(t, err)
+
+	got, truncated, err := complete([]byte("{\"a\": [1]}}\ntrailing"))
+	assert.NoError(t, err)
+	assert.False(t, truncated)
+	assert.Equal(t, `{"a": [1]}`, string(got))
+}
+
+// TestParsePartial check incomplete entries are dropped and trailing bytes are ignored
+func TestParsePartial(t *testing.T) {
+	cfg, err := Parse([]byte(`{"config":{"database_families":[{"name":"e","num_stripes":85,"num_sub_stripes":12,"overlap":0.01667},{"name":"f","num_stripes":340,"num_sub_stripes":3,"overl`))
+	assert.NoError(t, err)
+	assert.True(t, cfg.Truncated)
+	assert.Equal(t, []Family{{Name: "e", NumStripes: 85, NumSubStripes: 12, Overlap: 0.01667}}, cfg.Families)
+
+	cfg, err = Parse([]byte(`{"config":{"database_families":[{"name":"f","num_stripes":340,"num_sub_stripes":3,"overl`))
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Families)
+
+	cfg, err = Parse([]byte("{\"config\":{\"database_families\":[{\"name\":\"f\",\"num_stripes\":340}]}}\ntrailing"))
+	assert.NoError(t, err)
+	assert.False(t, cfg.Truncated)
+	assert.Equal(t, []Family{{Name: "f", NumStripes: 340}}, cfg.Families)
+}
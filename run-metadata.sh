@@ -4,10 +4,9 @@ set -euxo pipefail
 
 DIR=$(cd "$(dirname "$0")"; pwd -P)
 
-CMD_DIR="$DIR/cmd/metadata"
-
-cd "$CMD_DIR"
-go build -o metadata main.go
-scp "$CMD_DIR"/metadata cc:/pbs/home/f/fjammes
-ssh cc "killall /pbs/home/f/fjammes/metadata" || true
-ssh cc "time /pbs/home/f/fjammes/metadata"
+cd "$DIR"
+go build -o /tmp/qserv-tools ./cmd/qserv-tools
+scp /tmp/qserv-tools cc:/pbs/home/f/fjammes
+scp config/config.example.yaml cc:/pbs/home/f/fjammes/qserv-tools.yaml
+ssh cc "killall /pbs/home/f/fjammes/qserv-tools" || true
+ssh cc "time /pbs/home/f/fjammes/qserv-tools metadata generate --config /pbs/home/f/fjammes/qserv-tools.yaml --profile cc-in2p3"
@@ -0,0 +1,187 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Generate table schemas for regular tables from CSV files with a header,
+// inferring MySQL types from sampled values
+
+package schema
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// NullValue is the representation of NULL in data files loaded by Qserv
+const NullValue = "\\N"
+
+// Integer types, from the smallest to the largest
+var intTypes = []struct {
+	name     string
+	min, max int64
+}{
+	{"tinyint(4)", math.MinInt8, math.MaxInt8},
+	{"smallint(6)", math.MinInt16, math.MaxInt16},
+	{"int(11)", math.MinInt32, math.MaxInt32},
+	{"bigint(20)", math.MinInt64, math.MaxInt64},
+}
+
+// Maximum length of a string column stored as varchar, longer ones are stored as text
+const maxVarcharLength = 255
+
+// columnStats accumulates what is known about the values of a column
+type columnStats struct {
+	values  int
+	nulls   int
+	isInt   bool
+	isFloat bool
+	minInt  int64
+	maxInt  int64
+	maxLen  int
+}
+
+func newColumnStats() *columnStats {
+	return &columnStats{isInt: true, isFloat: true, minInt: math.MaxInt64, maxInt: math.MinInt64}
+}
+
+func isNull(value string) bool {
+	return value == NullValue || value == ""
+}
+
+func (s *columnStats) add(value string) {
+	s.values++
+	if isNull(value) {
+		s.nulls++
+		return
+	}
+	if len(value) > s.maxLen {
+		s.maxLen = len(value)
+	}
+	if s.isInt {
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			s.isInt = false
+		} else {
+			if i < s.minInt {
+				s.minInt = i
+			}
+			if i > s.maxInt {
+				s.maxInt = i
+			}
+		}
+	}
+	if s.isFloat {
+		_, err := strconv.ParseFloat(value, 64)
+		s.isFloat = err == nil
+	}
+}
+
+// columnType returns the smallest MySQL type able to store all sampled values
+func (s *columnStats) columnType() string {
+	var colType string
+	switch {
+	case s.values == s.nulls:
+		colType = fmt.Sprintf("varchar(%d)", maxVarcharLength)
+	case s.isInt:
+		for _, t := range intTypes {
+			if s.minInt >= t.min && s.maxInt <= t.max {
+				colType = t.name
+				break
+			}
+		}
+	case s.isFloat:
+		colType = "double"
+	case s.maxLen <= maxVarcharLength:
+		colType = fmt.Sprintf("varchar(%d)", s.maxLen)
+	default:
+		colType = "text"
+	}
+	if s.nulls == 0 {
+		return colType + " NOT NULL"
+	}
+	return colType + " DEFAULT NULL"
+}
+
+// FromCSV returns a regular table whose columns are read from the header of a CSV file,
+// and whose types are inferred from the first sampleSize rows, or all rows if sampleSize is 0.
+// Columns without NULL values in the sample are declared NOT NULL.
+func FromCSV(csvFile string, table string, database string, delimiter rune, sampleSize int) (*Table, error) {
+	f, err := os.Open(csvFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if table == "" {
+		table = strings.TrimSuffix(filepath.Base(csvFile), filepath.Ext(csvFile))
+	}
+	r := csv.NewReader(f)
+	r.Comma = delimiter
+	r.LazyQuotes = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("in file %q, unable to read header: %v", csvFile, err)
+	}
+	stats := make([]*columnStats, len(header))
+	for i := range header {
+		stats[i] = newColumnStats()
+	}
+	for row := 0; sampleSize == 0 || row < sampleSize; row++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("in file %q: %v", csvFile, err)
+		}
+		for i, value := range record {
+			stats[i].add(value)
+		}
+	}
+
+	t := Table{
+		Database: database,
+		Table:    table,
+	}
+	for i, name := range header {
+		t.Schema = append(t.Schema, Column{Name: strings.TrimSpace(name), Type: stats[i].columnType()})
+	}
+	return &t, nil
+}
+
+// CSVCmd writes the table schema inferred from a CSV file to outDir
+func CSVCmd(csvFile string, outDir string, table string, database string, delimiter rune, sampleSize int) {
+
+	log.Info().Str("Path", csvFile).Int("Sample", sampleSize).Msg("Infer table schema from CSV file")
+	t, err := FromCSV(csvFile, table, database, delimiter, sampleSize)
+	if err != nil {
+		log.Fatal().AnErr("CSV", err).Msg("Error while reading CSV file")
+	}
+	writeTables([]Table{*t}, outDir)
+}
@@ -0,0 +1,37 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFromCSV check column types inferred from a CSV file
+func TestFromCSV(t *testing.T) {
+	csv := "filterId,filterName,photClam,refObjectId,comment\n" +
+		"0,u,1.5,1,\n" +
+		"1,g,2,3000000000,\\N\n" +
+		"127,r,3e-5,-4,\"a, b\"\n"
+	csvFile := filepath.Join(t.TempDir(), "Filter.csv")
+	assert.NoError(t, os.WriteFile(csvFile, []byte(csv), 0644))
+
+	table, err := FromCSV(csvFile, "", "qservTest_case01_qserv", ',', 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "Filter", table.Table)
+	assert.Equal(t, 0, table.IsPartitioned)
+	expected := []Column{
+		{Name: "filterId", Type: "tinyint(4) NOT NULL"},
+		{Name: "filterName", Type: "varchar(1) NOT NULL"},
+		{Name: "photClam", Type: "double NOT NULL"},
+		{Name: "refObjectId", Type: "bigint(20) NOT NULL"},
+		{Name: "comment", Type: "varchar(4) DEFAULT NULL"},
+	}
+	assert.Equal(t, expected, table.Schema)
+
+	table, err = FromCSV(csvFile, "Filter", "", ',', 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "tinyint(4) NOT NULL", table.Schema[3].Type, "Only the first row should be sampled")
+	assert.Equal(t, "varchar(255) DEFAULT NULL", table.Schema[4].Type)
+}
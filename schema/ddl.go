@@ -0,0 +1,207 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Generate table schemas for regular tables from MySQL CREATE TABLE statements
+
+package schema
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+)
+
+var createTable = regexp.MustCompile("(?is)CREATE\\s+TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?([`\\w.]+)\\s*\\(")
+
+// Keywords starting a table definition item which is not a column
+var ddlConstraints = []string{"PRIMARY", "KEY", "INDEX", "UNIQUE", "CONSTRAINT", "FOREIGN", "FULLTEXT", "SPATIAL", "CHECK"}
+
+// splitTopLevel splits s on sep characters located outside of parentheses and quotes
+func splitTopLevel(s string, sep func(rune) bool) []string {
+	var parts []string
+	depth := 0
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case depth == 0 && sep(r):
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// tableBody returns the content between the parenthesis starting at s[0] and its closing one
+func tableBody(s string) (string, error) {
+	depth := 0
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth == 0 {
+				return s[1:i], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unbalanced parentheses in CREATE TABLE statement")
+}
+
+func unquoteIdentifier(name string) string {
+	if i := strings.LastIndex(name, "."); i != -1 {
+		name = name[i+1:]
+	}
+	return strings.Trim(name, "`\"")
+}
+
+// ddlColumnType reduces a MySQL column definition to its type, nullability and default value,
+// dropping clauses like COMMENT or AUTO_INCREMENT
+func ddlColumnType(tokens []string) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+	colType := []string{tokens[0]}
+	i := 1
+	for ; i < len(tokens); i++ {
+		up := strings.ToUpper(tokens[i])
+		if strings.HasPrefix(tokens[i], "(") || up == "UNSIGNED" || up == "ZEROFILL" {
+			colType = append(colType, tokens[i])
+		} else {
+			break
+		}
+	}
+	notNull := false
+	defaultValue := ""
+	for ; i < len(tokens); i++ {
+		up := strings.ToUpper(tokens[i])
+		switch {
+		case up == "NOT" && i+1 < len(tokens) && strings.ToUpper(tokens[i+1]) == "NULL":
+			notNull = true
+			i++
+		case up == "DEFAULT" && i+1 < len(tokens):
+			defaultValue = tokens[i+1]
+			i++
+		}
+	}
+	def := strings.ReplaceAll(strings.Join(colType, " "), " (", "(")
+	hasDefault := defaultValue != "" && strings.ToUpper(defaultValue) != "NULL"
+	if notNull {
+		def += " NOT NULL"
+	}
+	if hasDefault {
+		def += " DEFAULT " + defaultValue
+	} else if !notNull {
+		def += " DEFAULT NULL"
+	}
+	return def
+}
+
+// parseCreateTable returns the regular table described by the body of a CREATE TABLE statement
+func parseCreateTable(name string, body string, database string) (*Table, error) {
+	t := Table{
+		Database: database,
+		Table:    unquoteIdentifier(name),
+	}
+	for _, item := range splitTopLevel(body, func(r rune) bool { return r == ',' }) {
+		tokens := splitTopLevel(strings.TrimSpace(item), func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' || r == '\r' })
+		var fields []string
+		for _, tok := range tokens {
+			if tok != "" {
+				fields = append(fields, tok)
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if slices.Contains(ddlConstraints, strings.ToUpper(fields[0])) {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("in table %q: invalid column definition %q", t.Table, item)
+		}
+		t.Schema = append(t.Schema, Column{Name: unquoteIdentifier(fields[0]), Type: ddlColumnType(fields[1:])})
+	}
+	if len(t.Schema) == 0 {
+		return nil, fmt.Errorf("no column found in table %q", t.Table)
+	}
+	return &t, nil
+}
+
+// FromDDL returns the regular tables described by the CREATE TABLE statements of a SQL file
+func FromDDL(sqlFile string, database string) ([]Table, error) {
+	b, err := os.ReadFile(sqlFile)
+	if err != nil {
+		return nil, err
+	}
+	sql := string(b)
+	var tables []Table
+	for _, loc := range createTable.FindAllStringSubmatchIndex(sql, -1) {
+		name := sql[loc[2]:loc[3]]
+		body, err := tableBody(sql[loc[1]-1:])
+		if err != nil {
+			return nil, fmt.Errorf("in file %q, table %q: %v", sqlFile, name, err)
+		}
+		t, err := parseCreateTable(name, body, database)
+		if err != nil {
+			return nil, fmt.Errorf("in file %q: %v", sqlFile, err)
+		}
+		tables = append(tables, *t)
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("no CREATE TABLE statement found in file %q", sqlFile)
+	}
+	return tables, nil
+}
+
+// DDLCmd writes the table schemas of the CREATE TABLE statements of a SQL file to outDir
+func DDLCmd(sqlFile string, outDir string, database string) {
+
+	log.Info().Str("Path", sqlFile).Msg("Convert CREATE TABLE statements")
+	tables, err := FromDDL(sqlFile, database)
+	if err != nil {
+		log.Fatal().AnErr("DDL", err).Msg("Error while reading SQL file")
+	}
+	writeTables(tables, outDir)
+}
@@ -0,0 +1,43 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFromDDL check a CREATE TABLE statement produces the schema of itest/case01/LeapSeconds.json
+func TestFromDDL(t *testing.T) {
+	sql := "-- Regular tables\n" +
+		"CREATE TABLE IF NOT EXISTS `qservTest_case01_qserv`.`LeapSeconds` (\n" +
+		"  `whenJd` float NOT NULL COMMENT 'JD of change, (TAI)',\n" +
+		"  `offset` float NOT NULL,\n" +
+		"  `mjdRef` float NOT NULL,\n" +
+		"  `drift` float NOT NULL,\n" +
+		"  `whenMjdUtc` float DEFAULT NULL,\n" +
+		"  `whenUtc` bigint(20) DEFAULT NULL,\n" +
+		"  `whenTai` bigint(20),\n" +
+		"  PRIMARY KEY (`whenJd`, `offset`)\n" +
+		") ENGINE=MyISAM;\n" +
+		"create table Filter (filterId tinyint(4) NOT NULL DEFAULT 0, filterName char(3) NOT NULL, photClam decimal (10, 2) unsigned);\n"
+	sqlFile := filepath.Join(t.TempDir(), "tables.sql")
+	assert.NoError(t, os.WriteFile(sqlFile, []byte(sql), 0644))
+
+	tables, err := FromDDL(sqlFile, "qservTest_case01_qserv")
+	assert.NoError(t, err)
+	assert.Len(t, tables, 2)
+
+	expected, err := Load(filepath.Join(itestDir(), "case01", "LeapSeconds.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, *expected, tables[0])
+
+	columns := []Column{
+		{Name: "filterId", Type: "tinyint(4) NOT NULL DEFAULT 0"},
+		{Name: "filterName", Type: "char(3) NOT NULL"},
+		{Name: "photClam", Type: "decimal(10, 2) unsigned DEFAULT NULL"},
+	}
+	assert.Equal(t, "Filter", tables[1].Table)
+	assert.Equal(t, columns, tables[1].Schema)
+}
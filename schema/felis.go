@@ -0,0 +1,343 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Convert Felis YAML data models (see lsst/sdm_schemas) to Qserv table schema JSON files
+//
+// Felis does not describe Qserv partitioning, which is derived from standard Felis fields:
+// director tables are given by name, their director key being their primary key, and a table
+// is a child of a director table if it has a ForeignKey constraint on the director key.
+// Latitude and longitude keys are the columns with "pos.eq.dec;meta.main" and
+// "pos.eq.ra;meta.main" as "ivoa:ucd".
+
+package schema
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+type felisSchema struct {
+	Name   string       `yaml:"name"`
+	Tables []felisTable `yaml:"tables"`
+}
+
+type felisTable struct {
+	Name        string            `yaml:"name"`
+	Id          string            `yaml:"@id"`
+	PrimaryKey  yaml.Node         `yaml:"primaryKey"`
+	Columns     []felisColumn     `yaml:"columns"`
+	Indexes     []felisIndex      `yaml:"indexes"`
+	Constraints []felisConstraint `yaml:"constraints"`
+}
+
+type felisColumn struct {
+	Name          string `yaml:"name"`
+	Id            string `yaml:"@id"`
+	Datatype      string `yaml:"datatype"`
+	Length        int    `yaml:"length"`
+	Nullable      *bool  `yaml:"nullable"`
+	MysqlDatatype string `yaml:"mysql:datatype"`
+	Ucd           string `yaml:"ivoa:ucd"`
+}
+
+type felisConstraint struct {
+	Name              string   `yaml:"name"`
+	Type              string   `yaml:"@type"`
+	Columns           []string `yaml:"columns"`
+	ReferencedColumns []string `yaml:"referencedColumns"`
+}
+
+// UCDs of the main position columns, used as latitude and longitude keys
+const (
+	latitudeUcd  = "pos.eq.dec;meta.main"
+	longitudeUcd = "pos.eq.ra;meta.main"
+)
+
+type felisIndex struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Columns     []string `yaml:"columns"`
+}
+
+// MySQL types for Felis datatypes, %d is replaced by column length
+var felisTypes = map[string]string{
+	"boolean":   "BOOLEAN",
+	"byte":      "TINYINT",
+	"short":     "SMALLINT",
+	"int":       "INT",
+	"long":      "BIGINT",
+	"float":     "FLOAT",
+	"double":    "DOUBLE",
+	"char":      "CHAR(%d)",
+	"string":    "VARCHAR(%d)",
+	"unicode":   "NVARCHAR(%d)",
+	"text":      "LONGTEXT",
+	"binary":    "LONGBLOB",
+	"timestamp": "DATETIME",
+}
+
+// felisRefs resolves Felis "@id" references to table and column names
+type felisRefs map[string]string
+
+func newFelisRefs(s *felisSchema) felisRefs {
+	refs := make(felisRefs)
+	for _, t := range s.Tables {
+		refs[t.Id] = t.Name
+		for _, c := range t.Columns {
+			refs[c.Id] = c.Name
+		}
+	}
+	return refs
+}
+
+// name returns the name referenced by ref, or ref itself if it is a plain name
+func (refs felisRefs) name(ref string) (string, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return ref, nil
+	}
+	name, ok := refs[ref]
+	if !ok {
+		return "", fmt.Errorf("unknown reference %q", ref)
+	}
+	return name, nil
+}
+
+// primaryKeys returns the columns references of a Felis primary key, which is a string or a list
+func (t *felisTable) primaryKeys() []string {
+	switch t.PrimaryKey.Kind {
+	case yaml.ScalarNode:
+		return []string{t.PrimaryKey.Value}
+	case yaml.SequenceNode:
+		var keys []string
+		for _, n := range t.PrimaryKey.Content {
+			keys = append(keys, n.Value)
+		}
+		return keys
+	}
+	return nil
+}
+
+func felisColumnType(c felisColumn, notNull bool) (string, error) {
+	colType := c.MysqlDatatype
+	if colType == "" {
+		format, ok := felisTypes[c.Datatype]
+		if !ok {
+			return "", fmt.Errorf("unsupported datatype %q for column %q", c.Datatype, c.Name)
+		}
+		colType = format
+		if strings.Contains(format, "%d") {
+			if c.Length <= 0 {
+				return "", fmt.Errorf("missing length for column %q with datatype %q", c.Name, c.Datatype)
+			}
+			colType = fmt.Sprintf(format, c.Length)
+		}
+	}
+	if notNull {
+		return colType + " NOT NULL", nil
+	}
+	return colType + " DEFAULT NULL", nil
+}
+
+// directorKeys returns the references of the director keys of the director tables named in directors,
+// mapped to their table names
+func directorKeys(s *felisSchema, directors []string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, name := range directors {
+		found := false
+		for i := range s.Tables {
+			ft := &s.Tables[i]
+			if ft.Name != name {
+				continue
+			}
+			found = true
+			primaryKeys := ft.primaryKeys()
+			if len(primaryKeys) != 1 {
+				return nil, fmt.Errorf("director table %q must have a single column primary key", name)
+			}
+			keys[primaryKeys[0]] = name
+		}
+		if !found {
+			return nil, fmt.Errorf("director table %q not found", name)
+		}
+	}
+	return keys, nil
+}
+
+// partitioning sets the director table and the director, latitude and longitude keys of t,
+// directors mapping the references of director keys to their tables
+func (ft *felisTable) partitioning(t *Table, refs felisRefs, directors map[string]string) error {
+	var err error
+	for _, ref := range ft.primaryKeys() {
+		if _, ok := directors[ref]; ok {
+			t.DirectorKey, err = refs.name(ref)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if t.DirectorKey == "" {
+		for _, c := range ft.Constraints {
+			if c.Type != "ForeignKey" || len(c.Columns) != 1 || len(c.ReferencedColumns) != 1 {
+				continue
+			}
+			director, ok := directors[c.ReferencedColumns[0]]
+			if !ok {
+				continue
+			}
+			column, err := refs.name(c.Columns[0])
+			if err != nil {
+				return fmt.Errorf("in constraint %q: %v", c.Name, err)
+			}
+			t.DirectorTable = director
+			t.DirectorKey = column
+		}
+	}
+	if t.DirectorKey == "" {
+		return nil
+	}
+	t.IsPartitioned = 1
+	for _, c := range ft.Columns {
+		switch c.Ucd {
+		case latitudeUcd:
+			t.LatitudeKey = c.Name
+		case longitudeUcd:
+			t.LongitudeKey = c.Name
+		}
+	}
+	return nil
+}
+
+// convertFelisTable returns the Qserv table schema and index configurations of a Felis table,
+// directors mapping the references of director keys to their tables
+func convertFelisTable(ft felisTable, refs felisRefs, directors map[string]string, database string) (*Table, []Index, error) {
+	t := Table{
+		Database: database,
+		Table:    ft.Name,
+	}
+	err := ft.partitioning(&t, refs, directors)
+	if err != nil {
+		return nil, nil, fmt.Errorf("in table %q: %v", ft.Name, err)
+	}
+
+	primaryKeys := make(map[string]bool)
+	for _, ref := range ft.primaryKeys() {
+		primaryKeys[ref] = true
+	}
+	for _, c := range ft.Columns {
+		notNull := primaryKeys[c.Id] || primaryKeys[c.Name] || (c.Nullable != nil && !*c.Nullable)
+		colType, err := felisColumnType(c, notNull)
+		if err != nil {
+			return nil, nil, fmt.Errorf("in table %q: %v", ft.Name, err)
+		}
+		t.Schema = append(t.Schema, Column{Name: c.Name, Type: colType})
+	}
+
+	if t.IsPartitioned == 1 {
+		for _, key := range []string{t.DirectorKey, t.LatitudeKey, t.LongitudeKey} {
+			if key != "" && t.Column(key) == -1 {
+				return nil, nil, fmt.Errorf("in table %q: partitioning column %q does not exist", ft.Name, key)
+			}
+		}
+		t.addPartitionColumns()
+	}
+
+	var indexes []Index
+	for _, fi := range ft.Indexes {
+		idx := Index{
+			Database: database,
+			Table:    ft.Name,
+			Index:    fi.Name,
+			Spec:     "DEFAULT",
+			Comment:  fi.Description,
+		}
+		for _, ref := range fi.Columns {
+			column, err := refs.name(ref)
+			if err != nil {
+				return nil, nil, fmt.Errorf("in index %q: %v", fi.Name, err)
+			}
+			idx.Columns = append(idx.Columns, IndexColumn{Column: column, Length: 0, Ascending: 1})
+		}
+		indexes = append(indexes, idx)
+	}
+	return &t, indexes, nil
+}
+
+// FromFelis returns the table schemas and index configurations described in a Felis YAML file,
+// directors being the names of the director tables, database defaults to the Felis schema name
+func FromFelis(felisFile string, database string, directors []string) ([]Table, []Index, error) {
+	buf, err := os.ReadFile(felisFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	var s felisSchema
+	err = yaml.Unmarshal(buf, &s)
+	if err != nil {
+		return nil, nil, fmt.Errorf("in file %q: %v", felisFile, err)
+	}
+	if database == "" {
+		database = s.Name
+	}
+
+	refs := newFelisRefs(&s)
+	keys, err := directorKeys(&s, directors)
+	if err != nil {
+		return nil, nil, fmt.Errorf("in file %q: %v", felisFile, err)
+	}
+	var tables []Table
+	var indexes []Index
+	for _, ft := range s.Tables {
+		t, idx, err := convertFelisTable(ft, refs, keys, database)
+		if err != nil {
+			return nil, nil, fmt.Errorf("in file %q: %v", felisFile, err)
+		}
+		tables = append(tables, *t)
+		indexes = append(indexes, idx...)
+	}
+	return tables, indexes, nil
+}
+
+// FelisCmd writes the table schemas of a Felis YAML file to outDir,
+// and their index configurations to idxDir if not empty
+func FelisCmd(felisFile string, outDir string, idxDir string, database string, directors []string) {
+
+	log.Info().Str("Path", felisFile).Strs("Directors", directors).Msg("Convert Felis data model")
+	tables, indexes, err := FromFelis(felisFile, database, directors)
+	if err != nil {
+		log.Fatal().AnErr("Felis", err).Msg("Error while reading data model")
+	}
+
+	writeTables(tables, outDir)
+	if idxDir == "" {
+		return
+	}
+	for _, idx := range indexes {
+		filename, err := idx.WriteFile(idxDir)
+		if err != nil {
+			log.Fatal().AnErr("Write", err).Msg("Error while writing index configuration")
+		}
+		log.Info().Str("Path", filename).Str("Index", idx.Index).Msg("Generate index configuration")
+	}
+}
@@ -0,0 +1,187 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Read and write Qserv table schema JSON files, like itest/case01/Object.json
+
+package schema
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Table is the content of a table schema JSON file
+type Table struct {
+	AuthKey       string   `json:"auth_key"`
+	Database      string   `json:"database"`
+	Table         string   `json:"table"`
+	IsPartitioned int      `json:"is_partitioned"`
+	DirectorTable string   `json:"director_table,omitempty"`
+	DirectorKey   string   `json:"director_key,omitempty"`
+	LatitudeKey   string   `json:"latitude_key,omitempty"`
+	LongitudeKey  string   `json:"longitude_key,omitempty"`
+	Schema        []Column `json:"schema"`
+}
+
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Index is the content of an index configuration file, like idx_Source_visit.json
+type Index struct {
+	Database string        `json:"database"`
+	Table    string        `json:"table"`
+	Index    string        `json:"index"`
+	Spec     string        `json:"spec"`
+	Comment  string        `json:"comment"`
+	Columns  []IndexColumn `json:"columns"`
+}
+
+type IndexColumn struct {
+	Column    string `json:"column"`
+	Length    int    `json:"length"`
+	Ascending int    `json:"ascending"`
+}
+
+// Columns added by the Qserv partitioner to partitioned tables
+var partitionColumns = []Column{
+	{Name: "chunkId", Type: "int(11) NOT NULL"},
+	{Name: "subChunkId", Type: "int(11) NOT NULL"},
+}
+
+// IsDirector returns true for a partitioned table which is not a child of another table
+func (t *Table) IsDirector() bool {
+	return t.IsPartitioned == 1 && t.DirectorTable == ""
+}
+
+// Column returns the position of a column in the schema, or -1 if it does not exist
+func (t *Table) Column(name string) int {
+	for i, c := range t.Schema {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// addPartitionColumns appends columns added by the Qserv partitioner, if missing
+func (t *Table) addPartitionColumns() {
+	for _, c := range partitionColumns {
+		if t.Column(c.Name) == -1 {
+			t.Schema = append(t.Schema, c)
+		}
+	}
+}
+
+// Load reads a table schema JSON file
+func Load(filename string) (*Table, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var t Table
+	err = json.Unmarshal(b, &t)
+	if err != nil {
+		return nil, fmt.Errorf("in file %q: %v", filename, err)
+	}
+	return &t, nil
+}
+
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// Write encodes a table schema using the layout of itest/case01 files,
+// with one line per column
+func (t *Table) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "{\n")
+	fmt.Fprintf(bw, "    \"auth_key\":%s,\n", quote(t.AuthKey))
+	fmt.Fprintf(bw, "    \"database\":%s,\n", quote(t.Database))
+	fmt.Fprintf(bw, "    \"table\":%s,\n", quote(t.Table))
+	fmt.Fprintf(bw, "    \"is_partitioned\":%d,\n", t.IsPartitioned)
+	if t.IsPartitioned == 1 {
+		fmt.Fprintf(bw, "    \"director_table\":%s,\n", quote(t.DirectorTable))
+		fmt.Fprintf(bw, "    \"director_key\":%s,\n", quote(t.DirectorKey))
+		fmt.Fprintf(bw, "    \"latitude_key\":%s,\n", quote(t.LatitudeKey))
+		fmt.Fprintf(bw, "    \"longitude_key\":%s,\n", quote(t.LongitudeKey))
+	}
+	fmt.Fprintf(bw, "    \"schema\":[\n")
+	for i, c := range t.Schema {
+		sep := ","
+		if i == len(t.Schema)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(bw, "        {\"name\":%s, \"type\":%s}%s\n", quote(c.Name), quote(c.Type), sep)
+	}
+	fmt.Fprintf(bw, "    ]\n")
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
+
+// WriteFile writes a table schema to <dir>/<table>.json
+func (t *Table) WriteFile(dir string) (string, error) {
+	filename := filepath.Join(dir, t.Table+".json")
+	f, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	err = t.Write(f)
+	if err != nil {
+		return "", err
+	}
+	return filename, f.Close()
+}
+
+// WriteFile writes an index configuration to <dir>/idx_<table>_<columns>.json
+func (idx *Index) WriteFile(dir string) (string, error) {
+	name := "idx_" + idx.Table
+	for _, c := range idx.Columns {
+		name += "_" + c.Column
+	}
+	filename := filepath.Join(dir, name+".json")
+	b, err := json.MarshalIndent(idx, "", "    ")
+	if err != nil {
+		return "", err
+	}
+	return filename, os.WriteFile(filename, append(b, '\n'), 0644)
+}
+
+// writeTables writes table schemas to outDir
+func writeTables(tables []Table, outDir string) {
+	for _, t := range tables {
+		filename, err := t.WriteFile(outDir)
+		if err != nil {
+			log.Fatal().AnErr("Write", err).Msg("Error while writing table schema")
+		}
+		log.Info().Str("Path", filename).Str("Table", t.Table).Msg("Generate table schema")
+	}
+}
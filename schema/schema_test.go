@@ -0,0 +1,83 @@
+package schema
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func itestDir() string {
+	_, filename, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(filepath.Dir(filename)), "itest")
+}
+
+// TestWrite check a table schema is written with the same layout as itest/case01 files
+func TestWrite(t *testing.T) {
+	filename := filepath.Join(itestDir(), "case01", "SimRefObject.json")
+	table, err := Load(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "refObjectId", table.Schema[0].Name)
+
+	var buf bytes.Buffer
+	assert.NoError(t, table.Write(&buf))
+	expected, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, string(bytes.TrimSpace(expected)), string(bytes.TrimSpace(buf.Bytes())))
+
+	table, err = Load(filepath.Join(itestDir(), "case01", "Object.json"))
+	assert.NoError(t, err)
+	assert.True(t, table.IsDirector())
+	assert.Equal(t, 2, table.Column("ra_PS"))
+}
+
+// TestFromFelis check conversion of itest/felis/test_schema.yaml
+func TestFromFelis(t *testing.T) {
+	felisFile := filepath.Join(itestDir(), "felis", "test_schema.yaml")
+	_, _, err := FromFelis(felisFile, "", []string{"Unknown"})
+	assert.Error(t, err, "Director tables should exist")
+
+	tables, indexes, err := FromFelis(felisFile, "", []string{"Object"})
+	assert.NoError(t, err)
+	assert.Len(t, tables, 3)
+
+	object := tables[0]
+	assert.Equal(t, "qservTest_felis", object.Database)
+	assert.True(t, object.IsDirector())
+	assert.Equal(t, "objectId", object.DirectorKey)
+	assert.Equal(t, "coord_dec", object.LatitudeKey)
+	assert.Equal(t, "coord_ra", object.LongitudeKey)
+	expected := []Column{
+		{Name: "objectId", Type: "BIGINT NOT NULL"},
+		{Name: "coord_ra", Type: "DOUBLE NOT NULL"},
+		{Name: "coord_dec", Type: "DOUBLE NOT NULL"},
+		{Name: "band", Type: "CHAR(1) DEFAULT NULL"},
+		{Name: "chunkId", Type: "int(11) NOT NULL"},
+		{Name: "subChunkId", Type: "int(11) NOT NULL"},
+	}
+	assert.Equal(t, expected, object.Schema)
+
+	source := tables[1]
+	assert.Equal(t, 1, source.IsPartitioned)
+	assert.Equal(t, "Object", source.DirectorTable)
+	assert.Equal(t, "objectId", source.DirectorKey)
+	assert.Equal(t, "coord_dec", source.LatitudeKey)
+	assert.Equal(t, "coord_ra", source.LongitudeKey)
+
+	filter := tables[2]
+	assert.Equal(t, 0, filter.IsPartitioned)
+	expected = []Column{
+		{Name: "filterId", Type: "TINYINT NOT NULL"},
+		{Name: "filterName", Type: "VARCHAR(3) NOT NULL"},
+	}
+	assert.Equal(t, expected, filter.Schema)
+
+	assert.Len(t, indexes, 1)
+	assert.Equal(t, []IndexColumn{{Column: "band", Length: 0, Ascending: 1}}, indexes[0].Columns)
+	filename, err := indexes[0].WriteFile(t.TempDir())
+	assert.NoError(t, err)
+	assert.Equal(t, "idx_Object_band.json", filepath.Base(filename))
+}
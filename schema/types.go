@@ -0,0 +1,163 @@
+/*
+* LSST Data Management System
+* See COPYRIGHT file at the top of the source tree.
+*
+* This product includes software developed by the
+* LSST Project (http://www.lsst.org/).
+*
+* This program is free software: you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*
+* You should have received a copy of the LSST License Statement and
+* the GNU General Public License along with this program. If not,
+* see <http://www.lsstcorp.org/LegalNotices/>.
+ */
+
+// Parse MySQL column types of table schemas and check data values against them
+
+package schema
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ColumnType is a parsed MySQL column definition, like "bigint(20) NOT NULL"
+type ColumnType struct {
+	// Lower case type name, like "bigint"
+	Base string
+	// Length of character and binary string types
+	Length   int
+	Unsigned bool
+	NotNull  bool
+}
+
+var columnTypeRe = regexp.MustCompile(`^\s*(\w+)\s*(?:\(\s*(\d+)\s*(?:,\s*\d+\s*)?\))?`)
+
+// Ranges of signed integer types, unsigned ones range from 0 to 2*max+1
+var intRanges = map[string]int64{
+	"tinyint":   math.MaxInt8,
+	"bool":      math.MaxInt8,
+	"boolean":   math.MaxInt8,
+	"smallint":  math.MaxInt16,
+	"mediumint": 1<<23 - 1,
+	"int":       math.MaxInt32,
+	"integer":   math.MaxInt32,
+	"bigint":    math.MaxInt64,
+}
+
+var floatTypes = map[string]int{
+	"float":   32,
+	"double":  64,
+	"real":    64,
+	"decimal": 64,
+	"numeric": 64,
+}
+
+var stringTypes = map[string]bool{
+	"char":      true,
+	"varchar":   true,
+	"binary":    false,
+	"varbinary": false,
+}
+
+// ParseType parses a MySQL column definition
+func ParseType(def string) (ColumnType, error) {
+	m := columnTypeRe.FindStringSubmatch(def)
+	if m == nil {
+		return ColumnType{}, fmt.Errorf("invalid column type %q", def)
+	}
+	ct := ColumnType{Base: strings.ToLower(m[1])}
+	if m[2] != "" {
+		ct.Length, _ = strconv.Atoi(m[2])
+	}
+	upper := strings.ToUpper(def)
+	ct.Unsigned = strings.Contains(upper, "UNSIGNED")
+	ct.NotNull = strings.Contains(upper, "NOT NULL")
+	return ct, nil
+}
+
+// unescape removes backslash escapes of a value read from a data file
+func unescape(value []byte) []byte {
+	if !strings.Contains(string(value), "\\") {
+		return value
+	}
+	out := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		out = append(out, value[i])
+	}
+	return out
+}
+
+func checkInt(value string, max int64, unsigned bool) error {
+	if unsigned {
+		u, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", value)
+		}
+		if max != math.MaxInt64 && u > uint64(2*max+1) {
+			return fmt.Errorf("integer %s out of range", value)
+		}
+		return nil
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", value)
+	}
+	if i > max || i < -max-1 {
+		return fmt.Errorf("integer %s out of range", value)
+	}
+	return nil
+}
+
+func checkFloat(value string, bitSize int) error {
+	f, err := strconv.ParseFloat(value, bitSize)
+	if err != nil {
+		return fmt.Errorf("invalid floating point number %q", value)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("unsupported floating point value %q", value)
+	}
+	return nil
+}
+
+// Check returns an error if value, as read from a data file, can not be loaded in a column of this type
+func (ct ColumnType) Check(value []byte) error {
+	if string(value) == NullValue {
+		if ct.NotNull {
+			return fmt.Errorf("NULL value in NOT NULL column")
+		}
+		return nil
+	}
+	if max, ok := intRanges[ct.Base]; ok {
+		return checkInt(string(value), max, ct.Unsigned)
+	}
+	if bitSize, ok := floatTypes[ct.Base]; ok {
+		return checkFloat(string(value), bitSize)
+	}
+	if isChar, ok := stringTypes[ct.Base]; ok && ct.Length > 0 {
+		v := unescape(value)
+		length := len(v)
+		if isChar {
+			length = utf8.RuneCount(v)
+		}
+		if length > ct.Length {
+			return fmt.Errorf("value of length %d exceeds %s(%d)", length, ct.Base, ct.Length)
+		}
+	}
+	return nil
+}
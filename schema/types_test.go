@@ -0,0 +1,58 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseType check parsing of column types found in itest/case01 schemas
+func TestParseType(t *testing.T) {
+	ct, err := ParseType(" bigint(20) NOT NULL")
+	assert.NoError(t, err)
+	assert.Equal(t, ColumnType{Base: "bigint", Length: 20, NotNull: true}, ct)
+
+	ct, err = ParseType("char(34) DEFAULT NULL")
+	assert.NoError(t, err)
+	assert.Equal(t, ColumnType{Base: "char", Length: 34}, ct)
+
+	ct, err = ParseType("DECIMAL(10, 2) unsigned")
+	assert.NoError(t, err)
+	assert.Equal(t, ColumnType{Base: "decimal", Length: 10, Unsigned: true}, ct)
+}
+
+// TestCheck check values against column types
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		def   string
+		value string
+		valid bool
+	}{
+		{"bigint(20) NOT NULL", "9223372036854775807", true},
+		{"bigint(20) NOT NULL", "9223372036854775808", false},
+		{"bigint(20) NOT NULL", `\N`, false},
+		{"bigint(20) DEFAULT NULL", `\N`, true},
+		{"tinyint(4) DEFAULT NULL", "-128", true},
+		{"tinyint(4) DEFAULT NULL", "128", false},
+		{"tinyint(3) unsigned", "255", true},
+		{"int(11) NOT NULL", "1.5", false},
+		{"BOOLEAN", "1", true},
+		{"float DEFAULT NULL", "0.0000137355", true},
+		{"float DEFAULT NULL", "1e39", false},
+		{"double NOT NULL", "-6.05493264867207", true},
+		{"double NOT NULL", "nan", false},
+		{"double NOT NULL", "", false},
+		{"char(3) NOT NULL", "abc", true},
+		{"char(3) NOT NULL", `a\,b`, true},
+		{"char(3) NOT NULL", "abcd", false},
+		{"varchar(2) NOT NULL", "éé", true},
+		{"varbinary(2) NOT NULL", "éé", false},
+		{"text NOT NULL", "anything", true},
+	}
+	for _, test := range tests {
+		ct, err := ParseType(test.def)
+		assert.NoError(t, err)
+		err = ct.Check([]byte(test.value))
+		assert.Equal(t, test.valid, err == nil, "Value %q for type %q, error: %v", test.value, test.def, err)
+	}
+}